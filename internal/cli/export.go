@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wxnacy/wgo/internal/handler"
+)
+
+// 导出通过 --load 加载的会话
+var exportCmd = &cobra.Command{
+	Use:   "export [文件]",
+	Short: "将 --load 加载的会话导出为独立的 Go 代码，_test.go 文件导出为 Example 函数",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if globalReq.LoadFile == "" {
+			return errors.New("请通过 --load 指定会话文件")
+		}
+		coder := handler.GetCoder()
+		if len(args) == 1 {
+			return coder.ExportFile(args[0])
+		}
+		code, err := coder.Export(handler.EXPORT_MAIN)
+		if err != nil {
+			return err
+		}
+		fmt.Print(code)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+	"github.com/wxnacy/wgo/internal/handler"
+	"github.com/wxnacy/wgo/internal/kernel"
+	"github.com/wxnacy/wgo/internal/terminal"
+)
+
+var (
+	kernelInstall bool
+	kernelDir     string
+)
+
+// Jupyter 内核
+var kernelCmd = &cobra.Command{
+	Use:   "kernel <连接文件>",
+	Short: "作为 Jupyter 内核运行，--install 安装内核描述文件",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if kernelInstall {
+			dir, err := kernel.InstallKernelSpec(kernelDir)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("已安装 Jupyter 内核到 %s\n", dir)
+			return nil
+		}
+		if len(args) == 0 {
+			return errors.New("请指定 Jupyter 的连接文件")
+		}
+		conn, err := kernel.ReadConnectionFile(args[0])
+		if err != nil {
+			return err
+		}
+		if err := handler.SetPrintColor(true); err != nil {
+			logger.Errorf("开启彩色输出失败: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		k := kernel.New(conn, kernel.Options{
+			Version:  Version,
+			Complete: terminal.StartCompleter(ctx),
+			Meta:     terminal.RunMetaCommand,
+		})
+		// Ctrl+C 只中断正在运行的代码，不结束内核
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		defer signal.Stop(sig)
+		go func() {
+			for range sig {
+				k.Interrupt()
+			}
+		}()
+		return k.Run(ctx)
+	},
+}
+
+func init() {
+	kernelCmd.Flags().BoolVar(&kernelInstall, "install", false, "安装 Jupyter 内核描述文件")
+	kernelCmd.Flags().StringVar(&kernelDir, "kernels-dir", "", "安装内核描述文件的目录，默认为当前用户的 Jupyter 内核目录")
+	rootCmd.AddCommand(kernelCmd)
+}
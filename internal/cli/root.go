@@ -1,13 +1,17 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/wxnacy/wgo/internal/config"
 	"github.com/wxnacy/wgo/internal/dto"
 	"github.com/wxnacy/wgo/internal/handler"
 	log "github.com/wxnacy/wgo/internal/logger"
@@ -18,6 +22,7 @@ var (
 	logger    = log.GetLogger()
 	startTime time.Time
 	globalReq = dto.NewGlobalReq()
+	inited    bool // 是否已经初始化工作目录，会话子进程不初始化，也不能删除
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -29,15 +34,44 @@ var rootCmd = &cobra.Command{
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		startTime = time.Now()
 		// 初始化应用
+		if globalReq.PrintMode != "" {
+			if err := handler.SetPrintMode(globalReq.PrintMode); err != nil {
+				return err
+			}
+		}
 		handler.Init()
+		inited = true
+		if globalReq.PersistCache {
+			if err := handler.EnablePersistentCache(); err != nil {
+				return err
+			}
+		}
+		if globalReq.UseProject {
+			if _, err := handler.EnableProject(); err != nil {
+				return err
+			}
+		}
+		if err := handler.SetExecutor(globalReq.Executor); err != nil {
+			return err
+		}
+		if err := handler.SetRunTimeout(globalReq.RunTimeout); err != nil {
+			return err
+		}
+		if err := handler.SetStdinFile(globalReq.StdinFile); err != nil {
+			return err
+		}
+		if globalReq.UseSession {
+			if err := handler.GetCoder().StartSession(); err != nil {
+				return err
+			}
+		}
+		if globalReq.LoadFile != "" {
+			return loadNotebook(globalReq.LoadFile)
+		}
 		return nil
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
-		if globalReq.IsProduction() {
-			handler.Destory()
-		}
-		duration := time.Since(startTime)
-		logger.Infof("命令执行耗时: %v\n", duration)
+		cleanup()
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// fmt.Println("wgo")
@@ -55,6 +89,35 @@ var rootCmd = &cobra.Command{
 
 var ErrQuit = errors.New("quit wgo")
 
+// 结束时关闭会话进程并删除工作目录
+// 命令返回错误时 cobra 不会调用 PersistentPostRun，由 Execute 调用
+func cleanup() {
+	if err := handler.GetCoder().CloseSession(); err != nil {
+		logger.Errorf("关闭会话进程失败: %v", err)
+	}
+	if globalReq.IsProduction() {
+		handler.Destory()
+	}
+	duration := time.Since(startTime)
+	logger.Infof("命令执行耗时: %v\n", duration)
+}
+
+// 加载会话文件，Ctrl+C 停止加载
+// 重新运行失败的输入只提示，不影响启动
+func loadNotebook(path string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	failed, err := handler.GetCoder().LoadNotebook(ctx, path)
+	if err != nil {
+		return fmt.Errorf("加载会话 %s 失败: %w", path, err)
+	}
+	for _, num := range failed {
+		fmt.Fprintf(os.Stderr, "In[%d] 重新运行失败，状态没有恢复\n", num)
+	}
+	fmt.Fprintf(os.Stderr, "已加载会话 %s\n", path)
+	return nil
+}
+
 func handleCmdErr(err error) {
 	if err != nil {
 		if err.Error() == "^D" ||
@@ -74,6 +137,9 @@ func handleCmdErr(err error) {
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		if inited {
+			cleanup()
+		}
 		os.Exit(1)
 	}
 }
@@ -81,6 +147,14 @@ func Execute() {
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&globalReq.IsVerbose, "verbose", "V", false, "打印 DEBUG 日志，通过 wgo log 查看")
 	rootCmd.PersistentFlags().StringVarP(&globalReq.Env, "env", "e", dto.ENV_PRODUCTION, "运行环境")
+	rootCmd.PersistentFlags().StringVar(&globalReq.Executor, "executor", handler.EXECUTOR_RUN, fmt.Sprintf("代码执行器，可选: %s", strings.Join(handler.ExecutorNames(), ", ")))
+	rootCmd.PersistentFlags().StringVar(&globalReq.PrintMode, "print", config.Get().PrintMode, fmt.Sprintf("自动打印的格式，可选: %s，也可以通过环境变量 WGO_PRINT_MODE 设置", strings.Join(handler.PrintModes(), ", ")))
+	rootCmd.PersistentFlags().BoolVar(&globalReq.UseProject, "project", config.Get().UseProject, "开启项目模式，在 Go 模块中运行时可以直接使用模块中的包，默认关闭，也可以通过环境变量 WGO_PROJECT 设置")
+	rootCmd.PersistentFlags().BoolVar(&globalReq.PersistCache, "persist-cache", config.Get().PersistCache, "将编译缓存保存在用户缓存目录中，跨会话复用，也可以通过环境变量 WGO_PERSIST_CACHE 设置")
+	rootCmd.PersistentFlags().DurationVar(&globalReq.RunTimeout, "timeout", config.Get().RunTimeout, "运行代码的超时时间，比如 30s，为 0 时不限制，使用 run 执行器时包括编译时间，build 执行器只计算运行时间，也可以通过环境变量 WGO_TIMEOUT 设置")
+	rootCmd.PersistentFlags().StringVar(&globalReq.StdinFile, "stdin", "", "从文件中读取运行代码时的 stdin，每次运行都从文件开头读取")
+	rootCmd.PersistentFlags().StringVar(&globalReq.LoadFile, "load", "", "启动时加载通过 :save 保存的会话文件，按顺序重新运行其中的输入")
+	rootCmd.PersistentFlags().BoolVar(&globalReq.UseSession, "session", false, "使用长驻会话进程运行代码，状态保存在子进程中，每次只执行新输入")
 	// rootCmd.PersistentFlags().StringVarP(&globalReq.Config, "config", "c", defaultConfig, "指定配置文件地址")
 
 	// root 参数
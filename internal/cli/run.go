@@ -1,35 +1,137 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/wxnacy/go-tools"
 	"github.com/wxnacy/wgo/internal/handler"
+	"github.com/wxnacy/wgo/internal/terminal"
 )
 
+// 运行失败，错误已经打印，只需要返回非 0 的退出码
+var errRunFailed = errors.New("运行失败")
+
+var runFile string
+
+// 运行代码
+// 功能需求:
+//   - 只有一个参数时，参数是文件则运行文件，否则作为一次输入运行，可以是元命令
+//   - 参数为 - 时从 stdin 读取，-f 指定文件时从文件读取，按行拆分为多次输入
+//   - 有多个参数时每个参数作为一次输入
+//   - 多次输入和交互模式一样依次运行，支持元命令，打印每次输入的输出，遇到失败的输入时停止
+//   - 运行失败时退出码为 1，包括元命令运行失败，错误打印到 stderr
 var runCmd = &cobra.Command{
-	Use: "run",
-	Run: func(cmd *cobra.Command, args []string) {
-		var out string
-		var err error
-		code := args[0]
-		if tools.FileExists(code) {
-			out, err = handler.RunCode(code)
-		} else {
-			out, err = handler.GetCoder().InputAndRun(code)
-		}
+	Use:   "run [代码或文件]...",
+	Short: "运行代码片段或 main.go 文件，- 从 stdin 读取多行输入，-f 从文件读取",
+	Example: `  wgo run 'time.Now()'
+  wgo run 'a := 1' 'a + 1'
+  echo 'a := 1
+a + 1' | wgo run -
+  wgo run -f steps.txt`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// 按下 Ctrl+C 时结束运行的代码，代码在单独的进程组中运行，不会收到终端的中断信号
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		inputs, fromStdin, err := readRunInputs(args)
 		if err != nil {
-			// 功能需求:
-			// - 将 err 使用红色字体打印
 			fmt.Fprintf(os.Stderr, "\033[31m%v\033[0m\n", err)
-		} else {
-			fmt.Println(out)
+			return errRunFailed
+		}
+		// 运行的代码读取 wgo 的 stdin，通过 --stdin 设置文件时从文件中读取
+		// 输入来自 stdin 时 stdin 已经读完，不再传给运行的代码
+		if !fromStdin {
+			ctx = handler.WithStdin(ctx, os.Stdin)
+		}
+		if inputs == nil && tools.FileExists(args[0]) {
+			return runCodeFile(ctx, args[0])
 		}
+		if inputs == nil {
+			inputs = args
+		}
+		return runInputs(ctx, inputs)
 	},
 }
 
+// 读取多次输入，只有一个参数时返回空，fromStdin 表示输入是否来自 stdin
+func readRunInputs(args []string) (inputs []string, fromStdin bool, err error) {
+	switch {
+	case runFile != "":
+		if len(args) > 0 {
+			return nil, false, errors.New("-f 不能和代码参数同时使用")
+		}
+		data, err := os.ReadFile(runFile)
+		if err != nil {
+			return nil, false, fmt.Errorf("读取输入文件失败: %w", err)
+		}
+		return handler.SplitInputs(string(data)), false, nil
+	case len(args) == 1 && args[0] == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, true, fmt.Errorf("读取 stdin 失败: %w", err)
+		}
+		return handler.SplitInputs(string(data)), true, nil
+	case len(args) == 0:
+		return nil, false, errors.New("请指定要运行的代码或文件，- 从 stdin 读取，-f 从文件读取")
+	case len(args) == 1:
+		return nil, false, nil
+	default:
+		return args, false, nil
+	}
+}
+
+// 运行文件
+func runCodeFile(ctx context.Context, path string) error {
+	out, err := handler.RunCode(ctx, path)
+	if err != nil {
+		// 功能需求:
+		// - 将 err 使用红色字体打印
+		fmt.Fprintf(os.Stderr, "\033[31m%v\033[0m\n", err)
+		return errRunFailed
+	}
+	fmt.Println(out)
+	return nil
+}
+
+// 依次运行多次输入，遇到失败的输入或者元命令时停止
+func runInputs(ctx context.Context, inputs []string) error {
+	coder := handler.GetCoder()
+	for _, input := range inputs {
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+		if out, ok, err := terminal.RunMetaCommandErr(input); ok {
+			if out != "" {
+				fmt.Println(out)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\033[31m%v\033[0m\n", err)
+				return errRunFailed
+			}
+			continue
+		}
+		out, err := coder.InputAndRunContext(ctx, input)
+		if out != "" {
+			fmt.Println(out)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\033[31m%v\033[0m\n", err)
+			return errRunFailed
+		}
+	}
+	return nil
+}
+
 func init() {
+	runCmd.Flags().StringVarP(&runFile, "file", "f", "", "从文件中按行读取输入，和交互模式一样依次运行")
 	rootCmd.AddCommand(runCmd)
 }
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/wxnacy/wgo/internal/handler"
+)
+
+// 元命令运行失败时 wgo run 返回 errRunFailed，Execute 以退出码 1 退出
+func TestRunMetaCommandFails(t *testing.T) {
+	req := handler.GetRequest()
+	saved := *req
+	workspace := t.TempDir()
+	req.Workspace = workspace
+	req.MainDir = filepath.Join(workspace, ".wgo", req.ID)
+	req.MainFile = filepath.Join(req.MainDir, "main.go")
+	t.Cleanup(func() {
+		cleanup()
+		*req = saved
+	})
+
+	for _, args := range [][]string{{"run", ":nope"}, {"run", "1 + 1", ":nope"}, {"run", ":print nope"}} {
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); !errors.Is(err, errRunFailed) {
+			t.Fatalf("%v 应返回 errRunFailed，实际: %v", args, err)
+		}
+	}
+}
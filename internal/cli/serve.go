@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+	"github.com/wxnacy/wgo/internal/server"
+	"github.com/wxnacy/wgo/internal/terminal"
+)
+
+var serveStdio bool
+
+// 无界面的 JSON-RPC 服务，供编辑器插件使用
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "启动 JSON-RPC 服务，--stdio 通过标准输入输出通信，供编辑器插件运行代码",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !serveStdio {
+			return errors.New("请通过 --stdio 指定通信方式")
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s := server.New(server.Options{
+			Complete: terminal.StartCompleter(ctx),
+			Meta:     terminal.RunMetaCommand,
+		})
+		// Ctrl+C 只中断正在运行的代码，输入结束时退出
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		defer signal.Stop(sig)
+		go func() {
+			for range sig {
+				s.Interrupt()
+			}
+		}()
+		return s.Serve(ctx, os.Stdin, os.Stdout)
+	},
+}
+
+func init() {
+	serveCmd.Flags().BoolVar(&serveStdio, "stdio", false, "通过标准输入输出通信，每行一个 JSON-RPC 2.0 消息")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wxnacy/wgo/internal/handler"
+)
+
+// 会话子进程，由 --session 模式在内部启动
+var sessionCmd = &cobra.Command{
+	Use:    handler.SESSION_COMMAND,
+	Short:  "长驻会话子进程（内部使用）",
+	Hidden: true,
+	// 子进程不需要初始化工作目录，也不能在结束时删除父进程的工作目录
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return handler.RunSessionChild()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionCmd)
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"sync"
+	"time"
 )
 
 // import "github.com/zhufuyi/sponge/pkg/conf"
@@ -22,6 +24,16 @@ func Get() *Config {
 		onceConfig.Do(func() {
 			config = &Config{
 				LoggerFile: os.Getenv("HOME") + "/.local/share/wgo/log/wgo.log",
+				PrintMode:  os.Getenv("WGO_PRINT_MODE"),
+			}
+			if persist, err := strconv.ParseBool(os.Getenv("WGO_PERSIST_CACHE")); err == nil {
+				config.PersistCache = persist
+			}
+			if project, err := strconv.ParseBool(os.Getenv("WGO_PROJECT")); err == nil {
+				config.UseProject = project
+			}
+			if timeout, err := time.ParseDuration(os.Getenv("WGO_TIMEOUT")); err == nil {
+				config.RunTimeout = timeout
 			}
 		})
 	}
@@ -30,4 +42,12 @@ func Get() *Config {
 
 type Config struct {
 	LoggerFile string `yaml:"logger_file" json:"logger_file"`
+	// 自动打印的格式: pretty、v、+v、#v、json，为空时使用 pretty
+	PrintMode string `yaml:"print_mode" json:"print_mode"`
+	// 是否将编译缓存保存在用户缓存目录中，跨会话复用
+	PersistCache bool `yaml:"persist_cache" json:"persist_cache"`
+	// 是否开启项目模式，默认关闭
+	UseProject bool `yaml:"use_project" json:"use_project"`
+	// 运行代码的超时时间，为 0 时不限制
+	RunTimeout time.Duration `yaml:"run_timeout" json:"run_timeout"`
 }
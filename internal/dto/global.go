@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 const (
 	ENV_PRODUCTION = "production"
 	ENV_DEV        = "dev"
@@ -12,8 +14,16 @@ func NewGlobalReq() *GlobalReq {
 }
 
 type GlobalReq struct {
-	IsVerbose bool
-	Env       string
+	IsVerbose    bool
+	Env          string
+	UseSession   bool          // 是否使用长驻会话进程
+	Executor     string        // 代码执行器名称
+	UseProject   bool          // 是否开启项目模式，可以直接使用当前模块中的包
+	PrintMode    string        // 自动打印的格式
+	PersistCache bool          // 是否持久化编译缓存
+	RunTimeout   time.Duration // 运行代码的超时时间，为 0 时不限制
+	StdinFile    string        // 预先读入 stdin 的文件
+	LoadFile     string        // 启动时加载的会话文件
 }
 
 // 是否为开发环境
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// 表达式结果的分类
+type ResultKind int
+
+const (
+	RESULT_UNKNOWN ResultKind = iota // 无法判断，比如表达式中有未定义的名称
+	RESULT_NONE                      // 没有返回值的调用，比如 time.Sleep(1)
+	RESULT_VALUE                     // 一个值
+	RESULT_ERROR                     // 只返回一个 error 的调用，比如 os.Remove(p)
+	RESULT_MULTI                     // 多个返回值的调用，比如 strconv.Atoi(s)
+)
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// 表达式的类型信息
+type ExprResult struct {
+	Kind  ResultKind
+	Types []types.Type // 调用表达式为各个返回值的类型，其他表达式为表达式本身的类型
+	Names []string     // 多返回值的名称，没有命名时为空字符串
+}
+
+// 通过类型检查分析 code 中 main 函数结尾处表达式的类型
+// 功能需求:
+// - exprs 作为单独的语句追加到 main 函数结尾，只做类型检查，不会运行
+// - 先进行 imports 操作补全导入，再通过 go/packages 在会话目录中加载，和运行时使用相同的模块、依赖以及同目录的其他文件
+// - 代码中的其他错误不影响分析，比如未使用的变量，无法确定类型的表达式返回 RESULT_UNKNOWN
+// - 分析结果按照代码内容保存在编译缓存中
+func (c *Coder) AnalyzeExprs(code string, exprs ...string) ([]ExprResult, error) {
+	src, err := appendMainStmts(code, exprs)
+	if err != nil {
+		return nil, err
+	}
+	mainFile := GetMainFile()
+	// 会话目录还没有初始化时，比如没有调用 Init 直接使用，保证可以使用标准库
+	if err := InitModFile(filepath.Dir(mainFile)); err != nil {
+		return nil, err
+	}
+	content, err := processImports(mainFile, []byte(src))
+	if err != nil {
+		return nil, err
+	}
+
+	cache := GetCompileCache()
+	key := cache.Key(filepath.Dir(mainFile), []byte(mainFile), content)
+	if results, ok := cache.Analysis(key); ok {
+		return results, nil
+	}
+	results, err := analyzeMainStmts(mainFile, content, len(exprs))
+	if err != nil {
+		return nil, err
+	}
+	cache.SetAnalysis(key, results)
+	return results, nil
+}
+
+// 获取单个表达式的类型信息，分析失败时返回 RESULT_UNKNOWN
+func (c *Coder) AnalyzeExpr(code, expr string) ExprResult {
+	results, err := c.AnalyzeExprs(code, expr)
+	if err != nil {
+		logger.Debugf("分析表达式 %s 失败: %v", expr, err)
+		return ExprResult{Kind: RESULT_UNKNOWN}
+	}
+	return results[0]
+}
+
+// 将 stmts 逐行插入到 main 函数的结尾
+func appendMainStmts(code string, stmts []string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, 0)
+	if err != nil {
+		return "", fmt.Errorf("解析代码失败: %w", err)
+	}
+	mainFunc := findMainFunc(file)
+	if mainFunc == nil || mainFunc.Body == nil {
+		return "", errors.New("没有找到 main 函数")
+	}
+	offset := fset.Position(mainFunc.Body.Rbrace).Offset
+	var b strings.Builder
+	b.WriteString(code[:offset])
+	for _, stmt := range stmts {
+		b.WriteString("\n" + stmt)
+	}
+	b.WriteString("\n" + code[offset:])
+	return b.String(), nil
+}
+
+// 加载 mainFile 所在的包，获取 main 函数最后 n 个语句的类型
+func analyzeMainStmts(mainFile string, content []byte, n int) ([]ExprResult, error) {
+	dir := filepath.Dir(mainFile)
+	cfg := &packages.Config{
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+		Dir:     dir,
+		Env:     append(os.Environ(), sessionGoEnv(dir)...),
+		Overlay: map[string][]byte{mainFile: content},
+	}
+	pkgs, err := packages.Load(cfg, ".")
+	if err != nil {
+		return nil, fmt.Errorf("加载代码失败: %w", err)
+	}
+	for _, pkg := range pkgs {
+		for _, e := range pkg.Errors {
+			logger.Debugf("分析代码错误: %v", e)
+		}
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for i, file := range pkg.Syntax {
+			if i >= len(pkg.CompiledGoFiles) || filepath.Clean(pkg.CompiledGoFiles[i]) != filepath.Clean(mainFile) {
+				continue
+			}
+			mainFunc := findMainFunc(file)
+			if mainFunc == nil || mainFunc.Body == nil || len(mainFunc.Body.List) < n {
+				return nil, errors.New("没有找到 main 函数")
+			}
+			stmts := mainFunc.Body.List[len(mainFunc.Body.List)-n:]
+			results := make([]ExprResult, 0, n)
+			for _, stmt := range stmts {
+				exprStmt, ok := stmt.(*ast.ExprStmt)
+				if !ok {
+					results = append(results, ExprResult{Kind: RESULT_UNKNOWN})
+					continue
+				}
+				results = append(results, exprResult(exprStmt.X, pkg.TypesInfo.Types[exprStmt.X]))
+			}
+			return results, nil
+		}
+	}
+	return nil, fmt.Errorf("没有找到文件 %s", mainFile)
+}
+
+// 是否是 (T, error) 形式的返回值
+func (r ExprResult) IsValueError() bool {
+	return r.Kind == RESULT_MULTI && len(r.Types) == 2 && types.Identical(r.Types[1], errorType)
+}
+
+// 多返回值打印时使用的标签，有名称时使用名称，否则使用类型
+// 当前包中的类型不带包名，其他包的类型使用包名，比如 time.Time
+func (r ExprResult) Labels() []string {
+	labels := make([]string, 0, len(r.Types))
+	for i, t := range r.Types {
+		if i < len(r.Names) && r.Names[i] != "" && r.Names[i] != "_" {
+			labels = append(labels, r.Names[i])
+			continue
+		}
+		labels = append(labels, types.TypeString(t, func(pkg *types.Package) string {
+			if pkg.Name() == "main" {
+				return ""
+			}
+			return pkg.Name()
+		}))
+	}
+	return labels
+}
+
+// 根据表达式的类型进行分类
+func exprResult(expr ast.Expr, tv types.TypeAndValue) ExprResult {
+	if tv.IsVoid() {
+		return ExprResult{Kind: RESULT_NONE}
+	}
+	if tv.Type == nil || tv.Type == types.Typ[types.Invalid] {
+		return ExprResult{Kind: RESULT_UNKNOWN}
+	}
+	if tuple, ok := tv.Type.(*types.Tuple); ok {
+		result := ExprResult{Kind: RESULT_MULTI}
+		for i := 0; i < tuple.Len(); i++ {
+			result.Types = append(result.Types, tuple.At(i).Type())
+			result.Names = append(result.Names, tuple.At(i).Name())
+		}
+		if len(result.Types) == 0 {
+			result.Kind = RESULT_NONE
+		}
+		return result
+	}
+	result := ExprResult{Kind: RESULT_VALUE, Types: []types.Type{tv.Type}}
+	if _, isCall := ast.Unparen(expr).(*ast.CallExpr); isCall && types.Identical(tv.Type, errorType) {
+		result.Kind = RESULT_ERROR
+	}
+	return result
+}
+
+// 改写 main 函数中 v := f() 形式的赋值，f 返回 (T, error) 时改写为 v, err := f()，并在出错时打印错误
+// 功能需求:
+// - 只处理 main 函数中的顶层语句，左边只有一个变量，右边只有一个调用表达式
+// - 变量名是 err 或者 _ 时不处理
+// - 通过 AnalyzeExprs 一次分析所有候选调用的返回值
+// - 在赋值语句后追加 PRINT_ERROR_FUNC(err)，v 和 err 都作为变量保存，之后的输入可以继续使用
+func (c *Coder) rewriteErrorAssigns(code string) string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, 0)
+	if err != nil {
+		return code
+	}
+	mainFunc := findMainFunc(file)
+	if mainFunc == nil || mainFunc.Body == nil {
+		return code
+	}
+
+	var assigns []*ast.AssignStmt
+	var exprs []string
+	for _, stmt := range mainFunc.Body.List {
+		assign, ok := stmt.(*ast.AssignStmt)
+		if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			continue
+		}
+		ident, ok := assign.Lhs[0].(*ast.Ident)
+		if !ok || ident.Name == "err" || ident.Name == "_" {
+			continue
+		}
+		if _, ok := assign.Rhs[0].(*ast.CallExpr); !ok {
+			continue
+		}
+		assigns = append(assigns, assign)
+		exprs = append(exprs, code[fset.Position(assign.Rhs[0].Pos()).Offset:fset.Position(assign.Rhs[0].End()).Offset])
+	}
+	if len(assigns) == 0 {
+		return code
+	}
+	results, err := c.AnalyzeExprs(code, exprs...)
+	if err != nil {
+		logger.Debugf("分析赋值语句失败: %v", err)
+		return code
+	}
+
+	// 从后往前替换，保证前面的偏移量不变
+	for i := len(assigns) - 1; i >= 0; i-- {
+		if !results[i].IsValueError() {
+			continue
+		}
+		assign := assigns[i]
+		lhsEnd := fset.Position(assign.Lhs[0].End()).Offset
+		end := fset.Position(assign.End()).Offset
+		code = code[:lhsEnd] + ", err" + code[lhsEnd:end] + fmt.Sprintf("; %s(err)", PRINT_ERROR_FUNC) + code[end:]
+	}
+	return code
+}
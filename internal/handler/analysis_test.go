@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 通过类型检查区分调用表达式的返回值
+func TestAnalyzeExprs(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	code := `package main
+
+type Box[T any] struct{ v T }
+
+func (b Box[T]) Get() T { return b.v }
+
+func NewBox[T any](v T) Box[T] { return Box[T]{v} }
+
+func Sum(nums ...int) int { return len(nums) }
+
+func main() {
+	unused := 1
+}
+`
+	cases := map[string]ResultKind{
+		"time.Sleep(1)":                 RESULT_NONE,
+		"os.Remove(\"x\")":              RESULT_ERROR,
+		"(os.Remove(\"x\"))":            RESULT_ERROR,
+		"strconv.Atoi(\"1\")":           RESULT_MULTI,
+		"NewBox(1).Get()":               RESULT_VALUE,
+		"Sum(1, 2, 3)":                  RESULT_VALUE,
+		"strings.NewReader(\"\").Len()": RESULT_VALUE,
+		"errors.New(\"x\").Error()":     RESULT_VALUE,
+		"undefinedFunc()":               RESULT_UNKNOWN,
+	}
+	exprs := make([]string, 0, len(cases))
+	for expr := range cases {
+		exprs = append(exprs, expr)
+	}
+	results, err := c.AnalyzeExprs(code, exprs...)
+	if err != nil {
+		t.Fatalf("AnalyzeExprs 返回错误: %v", err)
+	}
+	for i, expr := range exprs {
+		if results[i].Kind != cases[expr] {
+			t.Fatalf("%s 分类不符合预期: 期望 %d 实际 %d", expr, cases[expr], results[i].Kind)
+		}
+	}
+	if multi := c.AnalyzeExpr(code, "strconv.Atoi(\"1\")"); len(multi.Types) != 2 || multi.Types[1].String() != "error" {
+		t.Fatalf("多返回值的类型不符合预期: %v", multi.Types)
+	}
+}
+
+// 只返回 error 的调用只在出错时打印
+func TestInputAndRunErrorOnlyCall(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	path := filepath.Join(t.TempDir(), "wgo.txt")
+	if err := WriteCode("wgo", path); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := c.InputAndRun("os.Remove(`" + path + "`)"); err != nil || out != "" {
+		t.Fatalf("删除成功时不应输出: %q %v", out, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("文件应已被删除: %v", err)
+	}
+	out, err := c.InputAndRun("os.Remove(`" + path + "`)")
+	if err != nil || !strings.Contains(out, "no such file or directory") {
+		t.Fatalf("删除失败时应输出错误: %q %v", out, err)
+	}
+}
+
+// 返回 (T, error) 时成功打印值，失败打印错误，其他多返回值打印为元组
+func TestInputAndRunMultiResults(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	steps := []struct {
+		input  string
+		expect string
+	}{
+		{`strconv.Atoi("12")`, "12"},
+		{`_ + 1`, "13"},
+		{`strconv.Atoi("x")`, `strconv.Atoi: parsing "x": invalid syntax`},
+		{`func() (int, string) { return 1, "a" }()`, `(int: 1, string: "a")`},
+		{`func() (n int, e error) { return 2, nil }()`, "2"},
+		{`func() (n int, s string, e error) { return }()`, `(n: 0, s: "", e: nil)`},
+	}
+	for _, step := range steps {
+		if out, err := c.InputAndRun(step.input); err != nil || out != step.expect {
+			t.Fatalf("%q 结果不符合预期: %q %v", step.input, out, err)
+		}
+	}
+}
+
+// v := f() 改写为 v, err := f()，变量可以继续使用，并报告错误
+func TestInputAndRunErrorAssign(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	steps := []struct {
+		input  string
+		expect string
+	}{
+		{`v := strconv.Atoi("7")`, ""},
+		{`v * 2`, "14"},
+		{`w := strconv.Atoi("y")`, `strconv.Atoi: parsing "y": invalid syntax`},
+		{`w`, "0"},
+	}
+	for _, step := range steps {
+		if out, err := c.InputAndRun(step.input); err != nil || out != step.expect {
+			t.Fatalf("%q 结果不符合预期: %q %v", step.input, out, err)
+		}
+	}
+}
+
+func TestRewriteErrorAssigns(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	code := "package main\n\nfunc main() {\n\tv := strconv.Atoi(\"1\")\n\tn := len(\"a\")\n\terr := os.Remove(\"x\")\n}\n"
+	expect := "package main\n\nfunc main() {\n\tv, err := strconv.Atoi(\"1\"); _PrintError(err)\n\tn := len(\"a\")\n\terr := os.Remove(\"x\")\n}\n"
+	if got := c.rewriteErrorAssigns(code); got != expect {
+		t.Fatalf("改写结果不符合预期:\n%s", got)
+	}
+}
@@ -5,9 +5,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
-
-	"github.com/wxnacy/go-tools"
 )
 
 // 功能需求
@@ -33,60 +30,37 @@ func InitBuiltinFuncCode(filename string) error {
 	return nil
 }
 
-// 通过运行代码判断方法是否有输出
-func HasFunctionReturnByRun(funcStr, mainFile string) bool {
-	tools.DirExistsOrCreate(filepath.Dir(mainFile))
-	code := fmt.Sprintf(PRINT_FUNC_HAS_OUT_TEMPLATE, funcStr)
-	logger.Debugf("HasFunctionReturnByRun code %s\n", code)
-	out, err := WriteAndRunCode(code, mainFile)
-	logger.Debugf("HasFunctionReturnByRun run out: %s err: %v", out, err)
-	if err != nil {
-		return false
-	}
-	flag, err := strconv.ParseBool(out)
-	if err != nil {
-		return false
-	}
-	return flag
-}
-
-const PRINT_FUNC_HAS_OUT_TEMPLATE = `package main
-
-import (
-	"fmt"
-	"reflect"
-)
-
-func HasOut(i any) bool {
-	t := reflect.TypeOf(i)
-	return t.NumOut() > 0
-}
-
-func main() {
-	fmt.Println(HasOut(%s))
-}
-`
-
 var BuiltinFuncCode = `package main
 
 import (
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 var (
-	RequestID string
-	TempDir   string
+	RequestID  string
+	TempDir    string
+	PrintMode  string // 自动打印的格式，为空时使用 pretty
+	PrintColor bool   // 自动打印时是否输出颜色
 )
 
+// 函数变量的序列化记录
+// Name 指向当前进程中的 funcRegistry，只在同一个进程内有效
+// Source 用于在新的进程中通过源码重建函数，闭包引用的外部变量在重建时从源码中解析
 type functionRecord struct {
-	Name string
+	Name   string
+	Source string
 }
 
 var typeRegistry = map[string]reflect.Type{
@@ -109,6 +83,7 @@ var typeRegistry = map[string]reflect.Type{
 var (
 	funcRegistry        = map[string]any{}
 	funcPointerRegistry = map[uintptr]string{}
+	funcSourceRegistry  = map[uintptr]string{}
 	funcRegistryMu      sync.RWMutex
 )
 
@@ -147,6 +122,15 @@ func _Serialize[T any](name string, value T) error {
 	return nil
 }
 
+// 序列化函数变量，同时保存函数的源码
+// 跨进程时函数无法直接反序列化，需要通过源码重建，重建时外部变量绑定到反序列化后的值
+func _SerializeFunc[T any](name string, value T, source string) error {
+	if isFuncValue(value) {
+		registerFuncSource(any(value), source)
+	}
+	return _Serialize(name, value)
+}
+
 func _Deserialize[T any](name string) (T, error) {
 	dir := GetSerializeDir()
 	filePath := filepath.Join(dir, name)
@@ -308,6 +292,9 @@ func serializeFuncValue(filePath string, fn any) error {
 	defer file.Close()
 
 	record := functionRecord{Name: name}
+	if source, ok := lookupFuncSource(fn); ok {
+		record.Source = source
+	}
 	if err := gob.NewEncoder(file).Encode(record); err != nil {
 		return fmt.Errorf("encode function record: %w", err)
 	}
@@ -324,7 +311,7 @@ func deserializeFuncValue[T any](filePath string) (T, error) {
 
 	fn, err := lookupFunc(record.Name)
 	if err != nil {
-		return zero, err
+		return zero, funcRebuildError(record, err)
 	}
 
 	converted, ok := fn.(T)
@@ -343,7 +330,7 @@ func deserializeFuncAny(filePath string, target reflect.Type) (any, error) {
 
 	fn, err := lookupFunc(record.Name)
 	if err != nil {
-		return nil, err
+		return nil, funcRebuildError(record, err)
 	}
 
 	value := reflect.ValueOf(fn)
@@ -401,4 +388,347 @@ func lookupFunc(name string) (any, error) {
 	}
 	return fn, nil
 }
+
+func registerFuncSource(fn any, source string) {
+	val := reflect.ValueOf(fn)
+	if !val.IsValid() || val.Kind() != reflect.Func || val.IsNil() {
+		return
+	}
+	funcRegistryMu.Lock()
+	funcSourceRegistry[val.Pointer()] = source
+	funcRegistryMu.Unlock()
+}
+
+func lookupFuncSource(fn any) (string, bool) {
+	val := reflect.ValueOf(fn)
+	if !val.IsValid() || val.Kind() != reflect.Func || val.IsNil() {
+		return "", false
+	}
+	funcRegistryMu.RLock()
+	defer funcRegistryMu.RUnlock()
+	source, ok := funcSourceRegistry[val.Pointer()]
+	return source, ok
+}
+
+// 函数不在当前进程中时，提示需要通过源码重建
+func funcRebuildError(record functionRecord, err error) error {
+	if record.Source == "" {
+		return err
+	}
+	return fmt.Errorf("%w，需要通过源码重建: %s", err, record.Source)
+}
+
+const (
+	PRINT_MODE_V      = "v"
+	PRINT_MODE_PLUS_V = "+v"
+	PRINT_MODE_SHARP  = "#v"
+	PRINT_MODE_JSON   = "json"
+	PRINT_MODE_PRETTY = "pretty"
+
+	printMaxItems = 100 // 切片、数组、map 最多打印的元素个数
+	printMaxDepth = 10  // 最多展开的嵌套层数
+	printMaxWidth = 80  // 复合类型的内容不超过该宽度时打印在一行中
+)
+
+const (
+	colorString  = "\033[32m"
+	colorNumber  = "\033[36m"
+	colorKeyword = "\033[35m"
+	colorType    = "\033[33m"
+	colorError   = "\033[31m"
+	colorReset   = "\033[0m"
+)
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// 打印自动输出的表达式，替代 fmt.Println
+// 功能需求:
+// - 多个值（比如多返回值的函数调用）使用空格分隔，和 fmt.Println 一致
+// - 按照 PrintMode 选择格式: v、+v、#v、json、pretty
+// - 顶层的字符串、error、fmt.Stringer 直接输出内容
+func _Print(values ...any) {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		parts = append(parts, formatValue(value))
+	}
+	fmt.Println(strings.Join(parts, " "))
+}
+
+// 打印自动输出的表达式，并保存为第 n 个输出，之后的输入可以通过 _、__、_n、Out[n] 引用
+// 只保存单个值，多返回值、nil 以及函数不保存，无法序列化的值只打印
+func _PrintOut(n int, values ...any) {
+	_Print(values...)
+	if len(values) != 1 || values[0] == nil || isFuncValue(values[0]) {
+		return
+	}
+	_Serialize(fmt.Sprintf("out-%d", n), values[0])
+}
+
+// 打印只返回 error 的调用的结果，error 为 nil 时不输出，否则高亮输出错误
+func _PrintError(err error) {
+	if err == nil {
+		return
+	}
+	fmt.Println(colorize(colorError, err.Error()))
+}
+
+// 打印返回 (T, error) 的调用的结果，使用方式为 _PrintResult(n)(f())
+// error 为 nil 时打印值并保存为第 n 个输出，否则高亮输出错误，n 为 0 时不保存
+func _PrintResult(n int) func(value any, err error) {
+	return func(value any, err error) {
+		if err != nil {
+			_PrintError(err)
+			return
+		}
+		if n > 0 {
+			_PrintOut(n, value)
+			return
+		}
+		_Print(value)
+	}
+}
+
+// 打印多返回值的调用的结果，使用方式为 _PrintTuple(labels...)(f())
+// labels 是各个返回值的名称或者类型，比如 (int: 1, string: "a")
+func _PrintTuple(labels ...string) func(values ...any) {
+	return func(values ...any) {
+		parts := make([]string, 0, len(values))
+		for i, value := range values {
+			label := strconv.Itoa(i)
+			if i < len(labels) && labels[i] != "" {
+				label = labels[i]
+			}
+			parts = append(parts, colorize(colorType, label)+": "+formatItem(value))
+		}
+		fmt.Println("(" + strings.Join(parts, ", ") + ")")
+	}
+}
+
+// 格式化复合结构中的一项，和 formatValue 不同的是字符串等需要带引号
+func formatItem(value any) string {
+	if PrintMode != "" && PrintMode != PRINT_MODE_PRETTY {
+		if PrintMode == PRINT_MODE_V || PrintMode == PRINT_MODE_PLUS_V {
+			if s, ok := value.(string); ok {
+				return strconv.Quote(s)
+			}
+		}
+		return formatValue(value)
+	}
+	p := &prettyPrinter{visited: make(map[uintptr]bool)}
+	return p.format(reflect.ValueOf(value), 1)
+}
+
+func formatValue(value any) string {
+	switch PrintMode {
+	case PRINT_MODE_V:
+		return fmt.Sprint(value)
+	case PRINT_MODE_PLUS_V:
+		return fmt.Sprintf("%+v", value)
+	case PRINT_MODE_SHARP:
+		return fmt.Sprintf("%#v", value)
+	case PRINT_MODE_JSON:
+		if s, ok := value.(string); ok {
+			return s
+		}
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return fmt.Sprintf("%+v", value)
+		}
+		return string(data)
+	}
+	switch v := value.(type) {
+	case nil:
+		return colorize(colorKeyword, "nil")
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		if rv := reflect.ValueOf(v); rv.Kind() != reflect.Pointer || !rv.IsNil() {
+			return v.String()
+		}
+	}
+	p := &prettyPrinter{visited: make(map[uintptr]bool)}
+	return p.format(reflect.ValueOf(value), 0)
+}
+
+// 带类型信息的格式化打印
+// 结构体显示字段名，指针显示指向的内容，map 按照 key 排序，内容过长时换行缩进
+type prettyPrinter struct {
+	visited map[uintptr]bool // 正在打印的指针，用于处理循环引用
+}
+
+func (p *prettyPrinter) format(v reflect.Value, depth int) string {
+	if !v.IsValid() {
+		return colorize(colorKeyword, "nil")
+	}
+	if depth > printMaxDepth {
+		return "..."
+	}
+	if v.CanInterface() && v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface {
+		if v.Type().Implements(errorType) {
+			return colorize(colorString, strconv.Quote(v.Interface().(error).Error()))
+		}
+		if v.Type().Implements(stringerType) {
+			return colorize(colorString, v.Interface().(fmt.Stringer).String())
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return colorize(colorKeyword, strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return colorize(colorNumber, fmt.Sprint(v))
+	case reflect.String:
+		return colorize(colorString, strconv.Quote(v.String()))
+	case reflect.Pointer:
+		if v.IsNil() {
+			return colorize(colorKeyword, "nil")
+		}
+		if p.visited[v.Pointer()] {
+			return "&<循环引用>"
+		}
+		p.visited[v.Pointer()] = true
+		defer delete(p.visited, v.Pointer())
+		return "&" + p.format(v.Elem(), depth)
+	case reflect.Interface:
+		if v.IsNil() {
+			return colorize(colorKeyword, "nil")
+		}
+		return p.format(v.Elem(), depth)
+	case reflect.Struct:
+		items := make([]string, 0, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			items = append(items, v.Type().Field(i).Name+": "+p.format(v.Field(i), depth+1))
+		}
+		return p.join(typeName(v.Type()), items, depth)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return typeName(v.Type()) + "(" + colorize(colorKeyword, "nil") + ")"
+		}
+		items := make([]string, 0, min(v.Len(), printMaxItems))
+		for i := 0; i < v.Len() && i < printMaxItems; i++ {
+			items = append(items, p.format(v.Index(i), depth+1))
+		}
+		if v.Len() > printMaxItems {
+			items = append(items, fmt.Sprintf("...（共 %d 项）", v.Len()))
+		}
+		return p.join(typeName(v.Type()), items, depth)
+	case reflect.Map:
+		if v.IsNil() {
+			return typeName(v.Type()) + "(" + colorize(colorKeyword, "nil") + ")"
+		}
+		keys := v.MapKeys()
+		sortMapKeys(keys)
+		items := make([]string, 0, min(len(keys), printMaxItems))
+		for i, key := range keys {
+			if i == printMaxItems {
+				items = append(items, fmt.Sprintf("...（共 %d 项）", len(keys)))
+				break
+			}
+			items = append(items, p.format(key, depth+1)+": "+p.format(v.MapIndex(key), depth+1))
+		}
+		return p.join(typeName(v.Type()), items, depth)
+	case reflect.Func:
+		if v.IsNil() {
+			return typeName(v.Type()) + "(" + colorize(colorKeyword, "nil") + ")"
+		}
+		return typeName(v.Type())
+	case reflect.Chan, reflect.UnsafePointer:
+		if v.IsNil() {
+			return typeName(v.Type()) + "(" + colorize(colorKeyword, "nil") + ")"
+		}
+		return fmt.Sprintf("%s(%#x)", typeName(v.Type()), v.Pointer())
+	}
+	return fmt.Sprint(v)
+}
+
+// 拼接复合类型的内容
+// 内容较短且都是单行时打印在一行中，否则每项一行并按层级缩进
+func (p *prettyPrinter) join(name string, items []string, depth int) string {
+	if len(items) == 0 {
+		return name + "{}"
+	}
+	width := 0
+	multiline := false
+	for _, item := range items {
+		width += visibleLen(item) + 2
+		if strings.Contains(item, "\n") {
+			multiline = true
+		}
+	}
+	if !multiline && width <= printMaxWidth {
+		return name + "{" + strings.Join(items, ", ") + "}"
+	}
+	indent := strings.Repeat("  ", depth+1)
+	var b strings.Builder
+	b.WriteString(name + "{\n")
+	for _, item := range items {
+		b.WriteString(indent + item + ",\n")
+	}
+	b.WriteString(strings.Repeat("  ", depth) + "}")
+	return b.String()
+}
+
+// 类型名称，去掉会话中声明的类型的 main. 前缀，匿名结构体显示为 struct
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Struct && t.Name() == "" {
+		return colorize(colorType, "struct")
+	}
+	return colorize(colorType, trimMainPrefix(t.String()))
+}
+
+var mainTypePrefixPattern = regexp.MustCompile("\\bmain\\.")
+
+// 去掉类型名称中 main 包的前缀，其他名称以 main 结尾的包比如 domain 保持不变
+func trimMainPrefix(name string) string {
+	return mainTypePrefixPattern.ReplaceAllString(name, "")
+}
+
+// map 的 key 排序，数字和字符串按值排序，其他类型按打印内容排序
+func sortMapKeys(keys []reflect.Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+}
+
+func colorize(color, s string) string {
+	if !PrintColor {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// 去掉颜色控制符后的字符数
+func visibleLen(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\033' {
+			for i < len(s) && s[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		if s[i]&0xC0 != 0x80 {
+			n++
+		}
+	}
+	return n
+}
 `
@@ -0,0 +1,365 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wxnacy/go-tools"
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	CACHE_KIND_BINARY  = "binary"  // 编译后的二进制文件
+	CACHE_KIND_IMPORTS = "imports" // goimports 处理后的代码
+	CACHE_KIND_TYPES   = "types"   // AnalyzeExprs 的类型分析结果
+
+	// 持久化缓存中超过该时间没有使用的二进制文件会被清理
+	CACHE_BINARY_MAX_AGE = 7 * 24 * time.Hour
+)
+
+var (
+	compileCache     *CompileCache
+	onceCompileCache sync.Once
+)
+
+// 缓存命中统计
+type CacheStats struct {
+	Hits   int
+	Misses int
+}
+
+// 编译缓存
+// 功能需求:
+// - 按照生成的代码内容寻址，缓存编译后的二进制文件、goimports 处理后的代码以及类型分析的结果
+// - key 中包含 go 版本、平台、go.mod、go.sum 以及 replace 到本地目录的模块文件信息，依赖或项目代码变化后不会命中旧的缓存
+// - 默认保存在会话的临时目录中，只在当前会话中有效，EnablePersistentCache 后保存在用户缓存目录中，跨会话复用
+// - goimports 和类型分析的结果只保存在内存中
+// - 每次查询都在 DEBUG 日志中记录命中情况
+// - 模块指纹在一次输入中只计算一次，避免每次查询都遍历本地模块目录，见 ResetFingerprints
+type CompileCache struct {
+	mu           sync.Mutex
+	dir          string // 缓存目录，为空时使用会话临时目录中的 cache 目录
+	persistent   bool
+	imports      map[string][]byte
+	analyses     map[string][]ExprResult
+	stats        map[string]*CacheStats
+	fingerprints map[string]string // 本次输入中已经计算的模块指纹，key 为代码所在目录
+}
+
+func newCompileCache(dir string) *CompileCache {
+	return &CompileCache{
+		dir:          dir,
+		imports:      make(map[string][]byte),
+		analyses:     make(map[string][]ExprResult),
+		stats:        make(map[string]*CacheStats),
+		fingerprints: make(map[string]string),
+	}
+}
+
+func GetCompileCache() *CompileCache {
+	if compileCache == nil {
+		onceCompileCache.Do(func() {
+			compileCache = newCompileCache("")
+		})
+	}
+	return compileCache
+}
+
+// 开启持久化缓存，缓存保存在用户缓存目录中，比如 ~/.cache/wgo
+// 同时清理长时间没有使用的二进制文件
+func EnablePersistentCache() error {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("获取用户缓存目录失败: %w", err)
+	}
+	return GetCompileCache().persist(filepath.Join(cacheDir, "wgo"))
+}
+
+func (c *CompileCache) persist(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建缓存目录失败: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = dir
+	c.persistent = true
+	c.pruneBinaries(CACHE_BINARY_MAX_AGE)
+	logger.Infof("使用持久化编译缓存 %s", dir)
+	return nil
+}
+
+// 缓存目录
+func (c *CompileCache) Dir() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cacheDir()
+}
+
+func (c *CompileCache) cacheDir() string {
+	if c.dir != "" {
+		return c.dir
+	}
+	return filepath.Join(GetTempDir(), "cache")
+}
+
+// 计算缓存的 key
+//   - dir: 代码所在目录，用来确定编译时使用的模块
+//   - parts: 代码内容等其他需要区分的信息
+func (c *CompileCache) Key(dir string, parts ...[]byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", c.fingerprint(dir))
+	for _, p := range parts {
+		fmt.Fprintf(h, "%d\x00", len(p))
+		h.Write(p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 获取 dir 的模块指纹，本次输入中已经计算过时直接返回
+func (c *CompileCache) fingerprint(dir string) string {
+	c.mu.Lock()
+	fp, ok := c.fingerprints[dir]
+	c.mu.Unlock()
+	if ok {
+		return fp
+	}
+	fp = moduleFingerprint(dir)
+	c.mu.Lock()
+	c.fingerprints[dir] = fp
+	c.mu.Unlock()
+	return fp
+}
+
+// 清空已经计算的模块指纹
+// 每次输入开始时调用，两次输入之间修改的项目代码和依赖在下一次输入中生效
+func (c *CompileCache) ResetFingerprints() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fingerprints = make(map[string]string)
+}
+
+// 编译 codePath 以及 files，返回二进制文件地址
+// 源码和模块都没有变化时直接返回之前编译的二进制文件
+func (c *CompileCache) Build(ctx context.Context, codePath string, files []string) (string, error) {
+	sources := append([]string{codePath}, files...)
+	hash, err := hashFiles(sources)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(codePath)
+	key := c.Key(dir, []byte(hash))
+
+	binPath := filepath.Join(c.Dir(), "bin", key)
+	if runtime.GOOS == "windows" {
+		binPath += ".exe"
+	}
+	if tools.FileExists(binPath) {
+		c.record(CACHE_KIND_BINARY, true)
+		now := time.Now()
+		os.Chtimes(binPath, now, now)
+		return binPath, nil
+	}
+	c.record(CACHE_KIND_BINARY, false)
+
+	if err := os.MkdirAll(filepath.Dir(binPath), 0o755); err != nil {
+		return "", fmt.Errorf("创建缓存目录失败: %w", err)
+	}
+	// 先编译到临时文件，避免并发运行时读到没有写完的二进制文件
+	tmpPath := fmt.Sprintf("%s.%d.tmp", binPath, os.Getpid())
+	begin := time.Now()
+	args := append([]string{"build", "-o", tmpPath}, sources...)
+	if _, err := GoCommandContext(ctx, dir, args...); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	logger.Debugf("编译缓存 编译耗时 %v", time.Since(begin))
+	if err := os.Rename(tmpPath, binPath); err != nil {
+		return "", fmt.Errorf("保存二进制文件失败: %w", err)
+	}
+	return binPath, nil
+}
+
+// 获取 goimports 处理后的代码
+func (c *CompileCache) Imports(key string) ([]byte, bool) {
+	c.mu.Lock()
+	code, ok := c.imports[key]
+	c.mu.Unlock()
+	c.record(CACHE_KIND_IMPORTS, ok)
+	return code, ok
+}
+
+func (c *CompileCache) SetImports(key string, code []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.imports[key] = code
+}
+
+// 获取类型分析的结果
+func (c *CompileCache) Analysis(key string) ([]ExprResult, bool) {
+	c.mu.Lock()
+	results, ok := c.analyses[key]
+	c.mu.Unlock()
+	c.record(CACHE_KIND_TYPES, ok)
+	return results, ok
+}
+
+func (c *CompileCache) SetAnalysis(key string, results []ExprResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.analyses[key] = results
+}
+
+// 获取各类缓存的命中统计
+func (c *CompileCache) Stats() map[string]CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make(map[string]CacheStats, len(c.stats))
+	for kind, s := range c.stats {
+		stats[kind] = *s
+	}
+	return stats
+}
+
+func (c *CompileCache) record(kind string, hit bool) {
+	c.mu.Lock()
+	s, ok := c.stats[kind]
+	if !ok {
+		s = &CacheStats{}
+		c.stats[kind] = s
+	}
+	result := "未命中"
+	if hit {
+		s.Hits++
+		result = "命中"
+	} else {
+		s.Misses++
+	}
+	hits, misses := s.Hits, s.Misses
+	c.mu.Unlock()
+	logger.Debugf("编译缓存 %s %s，累计命中 %d 次，未命中 %d 次", kind, result, hits, misses)
+}
+
+// 删除超过 maxAge 没有使用的二进制文件
+func (c *CompileCache) pruneBinaries(maxAge time.Duration) {
+	binDir := filepath.Join(c.cacheDir(), "bin")
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(binDir, entry.Name())); err != nil {
+			logger.Errorf("清理缓存文件失败: %v", err)
+		}
+	}
+}
+
+// 计算编译 dir 中代码时使用的模块的指纹
+// 功能需求:
+// - 包含 go 版本、平台、影响编译的环境变量以及 go.mod、go.sum 的内容
+// - replace 到本地目录的模块，比如项目模式下的项目根目录，包含目录中文件的路径、大小和修改时间
+// - 不在会话目录中的代码在当前目录中编译，当前目录所在的模块同样作为本地目录处理
+func moduleFingerprint(dir string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", goVersion(), runtime.GOOS, runtime.GOARCH)
+	for _, key := range []string{"GOFLAGS", "GOWORK", "CGO_ENABLED"} {
+		fmt.Fprintf(h, "%s=%s\x00", key, os.Getenv(key))
+	}
+
+	if sessionGoEnv(dir) == nil {
+		if wd, err := os.Getwd(); err == nil {
+			dir = wd
+		}
+	}
+	modPath := findModFile(dir)
+	if modPath == "" {
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	modDir := filepath.Dir(modPath)
+	data, _ := os.ReadFile(modPath)
+	sum, _ := os.ReadFile(filepath.Join(modDir, "go.sum"))
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", modPath, data, sum)
+
+	var localDirs []string
+	if sessionGoEnv(modDir) == nil {
+		localDirs = append(localDirs, modDir)
+	}
+	if f, err := modfile.Parse(modPath, data, nil); err == nil {
+		for _, r := range f.Replace {
+			if r.New.Version != "" {
+				continue
+			}
+			path := r.New.Path
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(modDir, path)
+			}
+			localDirs = append(localDirs, path)
+		}
+	}
+	sort.Strings(localDirs)
+	for _, d := range localDirs {
+		fingerprintDir(h, d)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 从 dir 开始向上查找 go.mod
+func findModFile(dir string) string {
+	for {
+		modPath := filepath.Join(dir, "go.mod")
+		if tools.FileExists(modPath) {
+			return modPath
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// 写入目录中 go 文件以及 go.mod、go.sum 的路径、大小和修改时间
+// 隐藏目录、testdata、vendor 以及其他模块的目录不处理
+func fingerprintDir(w io.Writer, root string) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path == root {
+				return nil
+			}
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" {
+				return filepath.SkipDir
+			}
+			if tools.FileExists(filepath.Join(path, "go.mod")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") && name != "go.mod" && name != "go.sum" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(w, "%s\x00%d\x00%d\x00", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 模块或 replace 的本地目录变化后，下一次输入的 key 随之变化
+func TestCompileCacheKeyTracksModule(t *testing.T) {
+	dir := filepath.Join(GetMainDir(), "cache_key_test")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := WriteCode("module wgosession\n\ngo 1.21\n", filepath.Join(dir, "go.mod")); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newCompileCache(t.TempDir())
+	key := cache.Key(dir, []byte("code"))
+	if key != cache.Key(dir, []byte("code")) {
+		t.Fatal("相同的代码和模块应得到相同的 key")
+	}
+	if key == cache.Key(dir, []byte("other")) {
+		t.Fatal("代码不同时 key 应该不同")
+	}
+
+	lib := t.TempDir()
+	libFile := filepath.Join(lib, "lib.go")
+	if err := WriteCode("package lib\n", libFile); err != nil {
+		t.Fatal(err)
+	}
+	mod := "module wgosession\n\ngo 1.21\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => " + lib + "\n"
+	if err := WriteCode(mod, filepath.Join(dir, "go.mod")); err != nil {
+		t.Fatal(err)
+	}
+	if key != cache.Key(dir, []byte("code")) {
+		t.Fatal("同一次输入中模块指纹只计算一次")
+	}
+	cache.ResetFingerprints()
+	replaced := cache.Key(dir, []byte("code"))
+	if replaced == key {
+		t.Fatal("go.mod 变化后 key 应该不同")
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(libFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	cache.ResetFingerprints()
+	if replaced == cache.Key(dir, []byte("code")) {
+		t.Fatal("本地模块文件变化后 key 应该不同")
+	}
+}
+
+// 持久化缓存清理长时间没有使用的二进制文件
+func TestCompileCachePersistPrunesBinaries(t *testing.T) {
+	dir := t.TempDir()
+	binDir := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old, fresh := filepath.Join(binDir, "old"), filepath.Join(binDir, "fresh")
+	for _, p := range []string{old, fresh} {
+		if err := WriteCode("", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-CACHE_BINARY_MAX_AGE - time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newCompileCache("")
+	if err := cache.persist(dir); err != nil {
+		t.Fatalf("persist 返回错误: %v", err)
+	}
+	if cache.Dir() != dir {
+		t.Fatalf("缓存目录不符合预期: %s", cache.Dir())
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatal("过期的二进制文件应被删除")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Fatalf("没有过期的二进制文件不应删除: %v", err)
+	}
+}
@@ -3,12 +3,14 @@ package handler
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"go/ast"
 	"go/format"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -18,16 +20,21 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/wxnacy/wgo/internal/logger"
 	"github.com/wxnacy/wgo/pkg/utils"
 )
 
 const (
-	VAR_PREFIX       = "var-"
-	INPUT_SUFFIX     = "// :INPUT"
-	DEFAULT_CODE_TPL = `package main
-
+	VAR_PREFIX        = "var-"
+	INPUT_SUFFIX      = "// :INPUT"
+	PRINT_FUNC        = "_Print"       // 自动打印使用的内置函数，按照 PrintMode 格式化输出
+	PRINT_ERROR_FUNC  = "_PrintError"  // 只返回 error 的调用使用的内置函数，只在出错时打印
+	PRINT_RESULT_FUNC = "_PrintResult" // 返回 (T, error) 的调用使用的内置函数，成功时打印值，否则打印错误
+	PRINT_TUPLE_FUNC  = "_PrintTuple"  // 多返回值的调用使用的内置函数，打印带标签的元组
+	DEFAULT_CODE_TPL  = `package main
+%s
 func main() {
 	%s
 }`
@@ -41,6 +48,11 @@ var (
 	errLineInfoPattern   = regexp.MustCompile(`^(.+?):(\d+)(?::\d+)?:\s*(.*)$`)
 )
 
+var (
+	ErrRunInterrupted = errors.New("运行已中断")
+	ErrRunTimeout     = errors.New("运行超时")
+)
+
 var ignoredRunErrorSubstrings = []string{
 	"no new variables on left side of :=",
 }
@@ -61,26 +73,56 @@ func GetCoder() *Coder {
 type Coder struct {
 	VarNames    []string          // 代码文件中 main 函数中出现的变量列表
 	FuncCodeMap map[string]string // 代码文件中 main 函数中出现的函数代码
+	DeclNames   []string          // 包级声明的名称列表，按首次声明的顺序排列
+	DeclCodeMap map[string]string // 包级声明的代码
+	Imports     []Import          // 通过 import 语句显式导入的包，按导入顺序排列
+	Cells       []Cell            // 输入记录，第 n 次输入为 Cells[n-1]
+
+	pending *pendingInput // 本次输入中的包级声明和导入，运行成功后保存
+	outNum  int           // 正在运行的输入编号，自动打印时保存为对应的输出结果
+
+	session     *Session // 会话模式下长驻的子进程
+	sessionRuns int      // 会话模式下执行的次数
 }
 
 // 输入并运行代码
 // 功能需求:
+// - 会话模式下直接交给会话子进程执行，不再重新生成 main 文件
+// - 记录输入编号，改写输入中 _、__、Out[n] 对之前输出结果的引用
+// - 多行输入中跨行的最后一个表达式合并为一行，以便自动打印
 // - 调用 InsertOrJoinCode 插入并拼接代码
 // - 调用 JoinPrintCode 拼接打印代码
+// - 调用 rewriteErrorAssigns 将 v := f() 改写为 v, err := f()，f 返回 (T, error) 时变量可以继续使用，并且报告错误
 // - 调用 SerializeCodeVars 收集并序列化参数列表
 // - 调用 WriteAndRunCode 写入并运行代码
-// - 调用 AfterRunCode 处理运行代码后的操作
+// - 调用 AfterRunCode 处理运行代码后的操作，运行成功后保存本次输入的声明和导入，以及自动打印的输出结果
+// - 每次输入只执行一次，重新生成的 main 函数中只有恢复变量、定义函数变量的代码以及本次输入，之前输入的语句不会重复执行
 func (c *Coder) InputAndRun(input string) (string, error) {
+	return c.InputAndRunContext(context.Background(), input)
+}
+
+// 和 InputAndRun 相同，ctx 取消或者运行超时时结束运行的代码，本次输入不会被保存
+func (c *Coder) InputAndRunContext(ctx context.Context, input string) (string, error) {
+	if c.session != nil {
+		return c.evalInSession(ctx, input)
+	}
+	GetCompileCache().ResetFingerprints()
+	num := c.startCell(input)
+	input = collapseLastExpr(c.rewriteOutRefs(input))
 	code := c.InsertOrJoinCode(input)
 	// 处理代码
+	c.outNum = num
 	code, err := c.JoinPrintCode(code)
-	code = c.SerializeCodeVars(code)
+	c.outNum = 0
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error processing code: %v\n", err)
+		c.recordCell(num, "", err)
 		return "", err
 	}
+	code = c.rewriteErrorAssigns(code)
+	code = c.SerializeCodeVars(code)
 	codePath := GetMainFile()
-	out, err := WriteAndRunCode(code, codePath)
+	out, err := WriteAndRunCode(ctx, code, codePath)
 	if err != nil {
 		logger.Errorf("RunCode Err:\n%v", err)
 	} else {
@@ -91,6 +133,12 @@ func (c *Coder) InputAndRun(input string) (string, error) {
 		code = string(latest)
 	}
 	out, err = c.AfterRunCode(code, out, err)
+	c.recordCell(num, out, err)
+	if err == nil || isIgnoredRunError(err.Error()) {
+		// 运行成功后才保存本次输入的声明和导入，避免错误的声明影响后续输入
+		c.commitPending()
+		c.finishCell(num)
+	}
 	return out, err
 }
 
@@ -109,6 +157,7 @@ func (c *Coder) InputAndRun(input string) (string, error) {
 // - runErr 不为空，作如下处理再进行返回
 //   - 去掉第一行 # command-line-arguments
 //   - 将每行错误的文件名和行号列号信息替换为 code 中对应行的代码
+//   - 运行时的 panic 通过 formatPanic 格式化为对应到输入的调用栈
 //
 // 增加测试用例
 func (c *Coder) AfterRunCode(code, runOut string, runErr error) (string, error) {
@@ -156,7 +205,10 @@ func (c *Coder) AfterRunCode(code, runOut string, runErr error) (string, error)
 		}
 	}
 
-	formatted := formatRunErrorMessage(code, errText)
+	formatted, isPanic := c.formatPanic(code, errText)
+	if !isPanic {
+		formatted = formatRunErrorMessage(code, errText)
+	}
 	if formatted != errText {
 		runErr = errors.New(formatted)
 	}
@@ -168,22 +220,43 @@ func (c *Coder) AfterRunCode(code, runOut string, runErr error) (string, error)
 // 功能需求：
 // - input 是需要插入的代码片段
 // - 如果 VarNames 有数据使用，参数列表使用 _Deserialize 拼接代码, 获取变量最终值
-//   - 如果变量是函数，直接拼接函数代码
+//   - 如果变量是函数，直接拼接函数代码，FuncCodeMap 中没有时从 _SerializeFunc 保存的记录中读取源码
+//   - 函数变量放在普通变量之后，闭包引用的其他函数变量先定义，递归函数先声明再赋值
 //
+// - 输入中引用的输出结果 _n 使用 _Deserialize 拼接代码
 // - 新输入的代码放在最后
-// - 最后将拼接好的代码拼接到魔板 DEFAULT_CODE_TPL 中
+// - 之前的输入只通过上面的方式恢复状态，不拼接之前输入的语句，避免 fmt.Println、os.WriteFile 等副作用重复执行
+// - 如果 input 是包级声明（type、func、方法、const、var 块）或 import 语句，不放入 main 函数
+//   - 记录到 pending 中，运行成功后再保存到 DeclCodeMap 和 Imports 中
+//
+// - 最后将 Imports、DeclCodeMap 中的声明和拼接好的代码拼接到魔板 DEFAULT_CODE_TPL 中
+//   - .type 中会话内声明的类型带有 main. 前缀，拼接时需要去掉
+//   - 项目模式下自动导入代码中用到的项目包
 func (c *Coder) InsertOrJoinCode(input string) string {
-	codes := make([]string, 0)
+	c.pending = nil
+	if decls, imports, ok := parseDeclInput(input); ok {
+		c.pending = &pendingInput{decls: decls, imports: imports}
+		input = ""
+	}
+	merged := c.mergePending(c.pending)
+
+	funcCodes := make(map[string]string)
 	for _, v := range c.VarNames {
+		if funcCode, exist := c.lookupFuncCode(v); exist {
+			funcCodes[v] = funcCode
+		}
+	}
+
+	codes := make([]string, 0)
+	for _, v := range orderReplayVars(c.VarNames, funcCodes) {
 		var line string
-		if funcCode, exist := c.FuncCodeMap[v]; exist {
+		if funcCode, exist := funcCodes[v]; exist {
 			// 函数变量直接填充代码
-			line = fmt.Sprintf("%s := %s", v, funcCode)
+			line = funcReplayLine(v, funcCode)
 		} else {
 			// 普通变量通过反序列化函数获取最终值
 			name := VAR_PREFIX + v
-			typePath := filepath.Join(GetTempDir(), name+".type")
-			typeName, err := ReadCode(typePath)
+			typeName, err := ReadVarType(v)
 			if err != nil {
 				continue
 			}
@@ -191,13 +264,23 @@ func (c *Coder) InsertOrJoinCode(input string) string {
 		}
 		codes = append(codes, line)
 	}
+	codes = append(codes, c.outReplayLines(input)...)
 	// 如果已经拼接过 INPUT_SUFFIX 不在拼接
 	if strings.Index(input, INPUT_SUFFIX) == -1 {
 		input += INPUT_SUFFIX
 	}
 	codes = append(codes, input)
 	code := strings.Join(codes, "\n")
-	return fmt.Sprintf(DEFAULT_CODE_TPL, code)
+	code = fmt.Sprintf(DEFAULT_CODE_TPL, merged.joinDeclCode(), code)
+	var verify []Import
+	if c.pending != nil {
+		verify = c.pending.imports
+	}
+	imports := append(merged.Imports, ProjectImports(code, merged.Imports)...)
+	if importCode := joinImportCode(imports, verify, code); importCode != "" {
+		code = strings.Replace(code, "package main\n", "package main\n"+importCode, 1)
+	}
+	return code
 }
 
 // 序列化代码中的变量
@@ -233,7 +316,7 @@ func (c *Coder) SerializeCodeVars(code string) string {
 	mainFunc.Body.List = removeSerializeStmts(mainFunc.Body.List)
 
 	orderedVars := collectSerializableVars(mainFunc.Body)
-	newSerialize := makeSerializeCalls(orderedVars, serializedNames)
+	newSerialize := makeSerializeCalls(fset, orderedVars, serializedNames)
 
 	mainFunc.Body.List = append(mainFunc.Body.List, append(originalSerialize, newSerialize...)...)
 
@@ -254,131 +337,23 @@ func (c *Coder) SerializeCodeVars(code string) string {
 	return buf.String()
 }
 
-// 插入代码并运行
-// 功能需求:
-// - 可以连续插入代码片段并成功运行并返回结果
-// - 代码的格式化和处理在 ProcessCode 中进行
-func (c *Coder) InsertCodeAndRun(input string) string {
-	codePath := GetMainFile()
-
-	// 确保 .wgo 目录存在
-	if err := os.MkdirAll(filepath.Dir(codePath), 0o755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating directory: %v\n", err)
-		return ""
-	}
-
-	// 检查文件是否存在，如果存在则读取现有代码
-	var existingCode string
-	if _, err := os.Stat(codePath); err == nil {
-		content, err := os.ReadFile(codePath)
-		if err == nil {
-			existingCode = string(content)
-		}
-	}
-
-	var code string
-	var mainContent string
-
-	// 提取现有代码中的变量声明信息
-	var existingVars map[string]bool = make(map[string]bool)
-
-	if existingCode != "" {
-		// 提取 main 函数内容
-		mainStart := strings.Index(existingCode, "func main() {")
-		mainEnd := strings.LastIndex(existingCode, "}")
-
-		if mainStart != -1 && mainEnd != -1 && mainEnd > mainStart {
-			// 提取 main 函数体内部的代码
-			mainContent = existingCode[mainStart+len("func main() {") : mainEnd]
-			mainContent = strings.TrimSpace(mainContent)
-
-			// 分析现有代码，找出所有变量声明
-			lines := strings.Split(mainContent, "\n")
-			for _, line := range lines {
-				trimmed := strings.TrimSpace(line)
-				// 匹配简单的变量声明
-				if strings.Contains(trimmed, ":=") && !strings.HasPrefix(trimmed, "_") && !strings.HasPrefix(trimmed, "func") && !strings.Contains(trimmed, ",") {
-					parts := strings.SplitN(trimmed, ":=", 2)
-					if len(parts) > 0 {
-						varName := strings.TrimSpace(parts[0])
-						// 只处理简单变量名
-						if !strings.Contains(varName, "(") && !strings.Contains(varName, "[") && varName != "" {
-							existingVars[varName] = true
-						}
-					}
-				}
-			}
-		}
-	}
-
-	// 处理输入代码，转换重复变量声明
-	processedInput := processVariableDeclarations(input, existingVars)
-
-	// 构建新的 main 函数内容
-	var newMainContent strings.Builder
-	if mainContent != "" {
-		newMainContent.WriteString(mainContent)
-		newMainContent.WriteString("\n")
-	}
-	newMainContent.WriteString(processedInput)
-
-	// 使用默认模板构建完整代码
-	code = fmt.Sprintf(DEFAULT_CODE_TPL, strings.TrimSpace(newMainContent.String()))
-
-	// 处理代码
-	processedCode, err := c.ProcessCode(code)
-	processedCode = c.SerializeCodeVars(processedCode)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error processing code: %v\n", err)
-		return code
-	}
-
-	// 写入文件
-	err = WriteCode(processedCode, codePath)
-	if err != nil {
-		fmt.Printf("写入临时文件失败: %v\n", err)
-		panic(err)
-	}
-
-	// 运行 imports
-	if _, err := ImportsInFile(codePath); err != nil {
-		logger.Errorf("imports failed: %v", err)
-		return err.Error()
-	}
-
-	// 运行代码
-	out, err := Command(
-		"go",
-		"run",
-		codePath,
-		filepath.Join(GetMainDir(), "builtin_func.go"),
-		filepath.Join(GetMainDir(), "request.go"),
-	)
-	if err != nil {
-		logger.Errorf("go run failed: %v", err)
-		// 即使执行失败，也返回输出
-		return out
-	}
-	return out + "\n"
-}
-
 // 格式化代码
 // - code 是个包含 main 函数的 go 代码
 // - 对 code 完成一下一些列操作后返回
 // - 目的是为了对 main 函数最后一行表达式进行执行或自动打印其结果
 //
 // 功能需求:
-// - 对未使用的表达式或参数使用 fmt.Println 进行包装
-//   - 比如 time.Now() => fmt.Println(time.Now())
-//   - 比如 t => fmt.Println(t) ，其中 t 是参数
-//   - 比如 a := time.Now(); a => a := time.Now() 换行 fmt.Println(a)
-//   - 比如 test := func ()  { return "wxnacy" }; test 方法格式化以后 换行 fmt.Println(test)
+// - 对未使用的表达式或参数使用 PRINT_FUNC 进行包装，按照 PrintMode 格式化输出
+//   - 比如 time.Now() => _Print(time.Now())
+//   - 比如 t => _Print(t) ，其中 t 是参数
+//   - 比如 a := time.Now(); a => a := time.Now() 换行 _Print(a)
+//   - 比如 test := func ()  { return "wxnacy" }; test 方法格式化以后 换行 _Print(test)
 //
-// - 以下情况不要进行 fmt.Println 封装
+// - 以下情况不要进行 PRINT_FUNC 封装
 //   - var 定义变量，比如 `var name string`
-//   - 如果表达式是函数执行，需要提前括号前的完整方法名字符串传入 `c.CanPrintFunction()` 方法获取是否有输出，如果返回 false 则不进行 fmt.Println 封装
-//     1 比如 `handler.Init()` => `c.CanPrintFunction(code, "handler.Init")`
-//     2 比如 `handler.GetCoder().JoinPrintCode("time.Now")` => `c.CanPrintFunction(code, "handler.GetCoder().JoinPrintCode")`
+//   - 如果表达式是函数执行，通过 autoPrintExpr 进行类型检查，没有返回值时不进行 PRINT_FUNC 封装
+//     1 比如 `time.Sleep(1)` 保持不变
+//     2 比如 `os.Remove(p)` 只返回 error，封装为 PRINT_ERROR_FUNC，只在出错时打印
 //
 // - 最后只保留最后一个 fmt.Print 开头的代码
 //
@@ -421,28 +396,12 @@ func (c *Coder) JoinPrintCode(code string) (string, error) {
 		replacement := indent + plain
 		if plain == "" {
 			replacement = indent
-		} else if !strings.HasPrefix(plain, "fmt.Print") &&
+		} else if !isPrintStmt(plain) && isExprSource(plain) &&
 			!strings.Contains(plain, ":=") && !strings.Contains(plain, "=") &&
 			!strings.HasPrefix(plain, "if ") && !strings.HasPrefix(plain, "for ") &&
 			!strings.HasPrefix(plain, "switch ") && !strings.HasPrefix(plain, "select ") &&
 			!strings.HasPrefix(plain, "var ") {
-			// 如果是调用表达式，提取括号前的完整方法名，调用 c.CanPrintFunction 判定
-			if idx := strings.Index(plain, "("); idx > 0 && strings.HasSuffix(plain, ")") {
-				name := extractFuncChain(plain[:idx])
-				if name != "" {
-					if c.CanPrintFunction(code, name) {
-						replacement = indent + fmt.Sprintf("fmt.Println(%s)", plain)
-					} else {
-						replacement = indent + plain
-					}
-				} else {
-					// 非标准选择器链，沿用旧逻辑：打印
-					replacement = indent + fmt.Sprintf("fmt.Println(%s)", plain)
-				}
-			} else {
-				// 非调用表达式，沿用旧逻辑：打印
-				replacement = indent + fmt.Sprintf("fmt.Println(%s)", plain)
-			}
+			replacement = indent + c.autoPrintExpr(code, plain, c.outNum)
 		}
 		newLines = append(newLines, replacement)
 
@@ -451,7 +410,7 @@ func (c *Coder) JoinPrintCode(code string) (string, error) {
 
 	joined := strings.Join(lines, "\n")
 
-	wrapped, err := wrapUnusedExpressions(joined)
+	wrapped, err := c.wrapUnusedExpressions(joined)
 	if err != nil {
 		return code, err
 	}
@@ -460,99 +419,6 @@ func (c *Coder) JoinPrintCode(code string) (string, error) {
 	return processed, nil
 }
 
-// ProcessCode 处理代码，满足以下功能：
-// - 包装未使用的表达式（如 time.Now()）为 fmt.Println 语句
-// - 只保留最后一个 fmt.Print 相关的语句
-// - 处理未使用的变量，添加 _ = var 到 main 函数末尾
-func (c *Coder) ProcessCode(code string) (string, error) {
-	processedCode, err := c.JoinPrintCode(code)
-	if err != nil {
-		return code, err
-	}
-
-	// 创建临时目录和文件来编译检查未使用变量
-	tmpDir, err := os.MkdirTemp("", "go-process-")
-	if err != nil {
-		return "", fmt.Errorf("creating temp dir: %w", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
-	tmpFile := filepath.Join(tmpDir, "main.go")
-	if err := os.WriteFile(tmpFile, []byte(processedCode), 0o644); err != nil {
-		return "", fmt.Errorf("writing temp file: %w", err)
-	}
-
-	// 初始化临时 go module
-	modCmd := exec.Command("go", "mod", "init", "tmpmodule")
-	modCmd.Dir = tmpDir
-	var modErr bytes.Buffer
-	modCmd.Stderr = &modErr
-	if err := modCmd.Run(); err != nil {
-		return "", fmt.Errorf("go mod init failed: %s", modErr.String())
-	}
-
-	// 运行 go build 并捕获 stderr，我们期望它在有未使用变量时失败
-	cmd := exec.Command("go", "build")
-	cmd.Dir = tmpDir
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	cmd.Run()
-
-	// 正则表达式查找 "declared and not used: var" 错误
-	re := regexp.MustCompile(`(?m)^.*: declared and not used: (\w+)$`)
-	matches := re.FindAllStringSubmatch(stderr.String(), -1)
-
-	var unusedVars []string
-	for _, match := range matches {
-		if len(match) > 1 {
-			unusedVars = append(unusedVars, match[1])
-		}
-	}
-
-	// 使用 AST 分析代码，找到 main 函数的结束位置
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, "", processedCode, 0)
-	if err != nil {
-		return "", fmt.Errorf("parsing code: %w", err)
-	}
-
-	var mainFuncEnd token.Pos = -1
-
-	// 分析 AST 找出 main 函数的右花括号位置
-	ast.Inspect(node, func(n ast.Node) bool {
-		if fn, ok := n.(*ast.FuncDecl); ok && fn.Name.Name == "main" {
-			mainFuncEnd = fn.Body.Rbrace
-			return false // 找到 main 函数后停止搜索
-		}
-		return true
-	})
-
-	if mainFuncEnd == -1 {
-		return "", fmt.Errorf("main function not found")
-	}
-
-	// 获取 main 函数右花括号的偏移量
-	offset := fset.File(mainFuncEnd).Offset(mainFuncEnd)
-
-	// 构建未使用变量的赋值语句
-	var assignments strings.Builder
-	for _, v := range unusedVars {
-		assignments.WriteString(fmt.Sprintf("\n\t_ = %s", v))
-	}
-
-	// 在右花括号前插入赋值语句
-	newCode := processedCode[:offset] + assignments.String() + "\n" + processedCode[offset:]
-
-	// 格式化代码以确保正确的缩进
-	formatted, err := format.Source([]byte(newCode))
-	if err != nil {
-		// 如果格式化失败，返回未格式化的版本
-		return newCode, nil
-	}
-
-	return string(formatted), nil
-}
-
 // 通过判断方法是否有返回值来确认是否可以打印
 // 参数：
 //   - code: 待解析的Go代码文本（需包含完整的包声明和函数定义）
@@ -560,31 +426,108 @@ func (c *Coder) ProcessCode(code string) (string, error) {
 //
 // 功能需求:
 //   - 先假设 funcName 在 code 中，判断方法是否有返回值
-//   - 有报错说明没有，那就通过 HasFunctionReturnByRun 判断方法是否有返回值
+//   - 有报错说明没有，那就通过 AnalyzeExpr 对 funcName 进行类型检查，判断函数签名是否有返回值
+//   - 类型检查失败时返回 false
 //
 // 测试用例
 //   - funcName 要有 code 中的一个方法
 //   - funcName 要有当前项目中一个其他包的方法
 func (c *Coder) CanPrintFunction(code, funcName string) bool {
-	flag, err := utils.HasFunctionReturnByCode(code, funcName)
+	if flag, err := utils.HasFunctionReturnByCode(code, funcName); err == nil {
+		return flag
+	}
+	result := c.AnalyzeExpr(code, funcName)
+	if result.Kind != RESULT_VALUE {
+		return false
+	}
+	sig, ok := result.Types[0].Underlying().(*types.Signature)
+	return ok && sig.Results().Len() > 0
+}
+
+// 拼接自动打印表达式的代码，num 大于 0 时同时保存为第 num 个输出结果
+// 功能需求:
+//   - 非调用表达式使用 printCall 打印
+//   - 调用表达式通过 AnalyzeExpr 进行类型检查，可以处理返回值上的方法调用、泛型以及可变参数
+//     1 没有返回值时保持不变，比如 `time.Sleep(1)`
+//     2 只返回 error 时使用 PRINT_ERROR_FUNC 封装，只在出错时打印，比如 `os.Remove(p)`
+//     3 返回 (T, error) 时使用 PRINT_RESULT_FUNC 封装，成功时打印并保存值，否则打印错误，比如 `strconv.Atoi(s)`
+//     4 其他多返回值使用 PRINT_TUPLE_FUNC 封装，打印带标签的元组
+//     5 其他情况使用 printCall 打印
+//   - 类型检查失败时通过调用名在 code 中查找函数定义，找不到时保持不变，交给编译报错
+func (c *Coder) autoPrintExpr(code, expr string, num int) string {
+	parsed, err := parser.ParseExpr(expr)
 	if err != nil {
-		flag = HasFunctionReturnByRun(funcName, filepath.Join(GetMainDir(), "print_func_has_out", "main.go"))
+		return expr
+	}
+	if _, ok := ast.Unparen(parsed).(*ast.CallExpr); !ok {
+		return printCall(num, expr)
+	}
+	result := c.AnalyzeExpr(code, expr)
+	switch {
+	case result.Kind == RESULT_NONE:
+		return expr
+	case result.Kind == RESULT_ERROR:
+		return fmt.Sprintf("%s(%s)", PRINT_ERROR_FUNC, expr)
+	case result.IsValueError():
+		return fmt.Sprintf("%s(%d)(%s)", PRINT_RESULT_FUNC, num, expr)
+	case result.Kind == RESULT_MULTI:
+		labels := make([]string, 0, len(result.Types))
+		for _, label := range result.Labels() {
+			labels = append(labels, strconv.Quote(label))
+		}
+		return fmt.Sprintf("%s(%s)(%s)", PRINT_TUPLE_FUNC, strings.Join(labels, ", "), expr)
+	case result.Kind == RESULT_VALUE:
+		return printCall(num, expr)
+	}
+	if idx := strings.Index(expr, "("); idx > 0 {
+		if name := extractFuncChain(expr[:idx]); name != "" {
+			if flag, err := utils.HasFunctionReturnByCode(code, name); err == nil && flag {
+				return printCall(num, expr)
+			}
+		}
 	}
-	return flag
+	return expr
+}
+
+// 是否是单独的表达式，多行输入的最后一行可能只是语句的一部分，比如 }
+func isExprSource(code string) bool {
+	_, err := parser.ParseExpr(code)
+	return err == nil
+}
+
+// 是否是打印语句，包括 fmt.Print 系列函数和自动打印的 PRINT_FUNC、PRINT_OUT_FUNC、PRINT_RESULT_FUNC、PRINT_TUPLE_FUNC
+// PRINT_ERROR_FUNC 只在出错时打印，作为普通语句处理
+func isPrintStmt(stmt string) bool {
+	for _, prefix := range []string{PRINT_FUNC, PRINT_OUT_FUNC, PRINT_RESULT_FUNC, PRINT_TUPLE_FUNC} {
+		if strings.HasPrefix(stmt, prefix+"(") {
+			return true
+		}
+	}
+	return strings.HasPrefix(stmt, "fmt.Print")
 }
 
 // processFmtPrintStatements 处理代码中的 fmt.Print 语句，只保留最后一个
+// 代码可以解析时只处理 main 函数中的顶层语句，for、if 等代码块中的打印语句保持不变
 func processFmtPrintStatements(code string) string {
 	// 按行分割代码
 	lines := strings.Split(code, "\n")
 	var newLines []string
 	var lastFmtPrintIndex int = -1
+	topLevel := topLevelStmtLines(code)
+	isPrintLine := func(i int, trimmed string) bool {
+		if topLevel != nil {
+			if _, ok := topLevel[i]; !ok {
+				return false
+			}
+		}
+		return isPrintStmt(trimmed) && strings.Contains(trimmed, "(") && strings.Contains(trimmed, ")")
+	}
 
 	// 第一次遍历：找出最后一个 fmt.Print 语句的索引
 	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
 		// 检查是否是 fmt.Print 系列函数调用
-		if strings.HasPrefix(trimmed, "fmt.Print") && strings.Contains(trimmed, "(") && strings.Contains(trimmed, ")") {
+		if isPrintLine(i, trimmed) {
 			lastFmtPrintIndex = i
 		}
 	}
@@ -592,7 +535,7 @@ func processFmtPrintStatements(code string) string {
 	// 第二次遍历：构建新代码，只保留最后一个 fmt.Print 语句
 	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
-		isFmtPrint := strings.HasPrefix(trimmed, "fmt.Print") && strings.Contains(trimmed, "(") && strings.Contains(trimmed, ")")
+		isFmtPrint := isPrintLine(i, trimmed)
 
 		// 如果不是 fmt.Print 语句，或者是最后一个 fmt.Print 语句，则保留
 		if !isFmtPrint || (lastFmtPrintIndex != -1 && i == lastFmtPrintIndex) {
@@ -604,8 +547,26 @@ func processFmtPrintStatements(code string) string {
 	return strings.Join(newLines, "\n")
 }
 
+// main 函数中顶层语句所在的行（从 0 开始），代码无法解析时返回 nil
+func topLevelStmtLines(code string) map[int]struct{} {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, 0)
+	if err != nil {
+		return nil
+	}
+	mainFunc := findMainFunc(file)
+	if mainFunc == nil || mainFunc.Body == nil {
+		return nil
+	}
+	lines := make(map[int]struct{}, len(mainFunc.Body.List))
+	for _, stmt := range mainFunc.Body.List {
+		lines[fset.Position(stmt.Pos()).Line-1] = struct{}{}
+	}
+	return lines
+}
+
 // wrapUnusedExpressions 检测并包装未使用的表达式，如 time.Now()
-func wrapUnusedExpressions(code string) (string, error) {
+func (c *Coder) wrapUnusedExpressions(code string) (string, error) {
 	// 简单的正则表达式来检测可能的未使用表达式
 	re := regexp.MustCompile(`(?m)^\s*(\w+(\.\w+)*\([^)]*\))\s*$`)
 
@@ -615,31 +576,16 @@ func wrapUnusedExpressions(code string) (string, error) {
 		if !strings.HasPrefix(strings.TrimSpace(line), "//") &&
 			!strings.Contains(line, ":=") &&
 			!strings.Contains(line, "=") &&
-			!strings.Contains(line, "fmt.Print") {
+			!strings.Contains(line, "fmt.Print") && !strings.Contains(line, PRINT_FUNC) {
 
 			// 检查是否是独立的函数调用表达式
 			if matches := re.FindStringSubmatch(line); len(matches) > 1 {
 				// 检查是否已经是有效的语句
 				trimmed := strings.TrimSpace(line)
 				if !strings.Contains(trimmed, ":=") && !strings.Contains(trimmed, "=") {
-					// 判断是否为函数调用且有返回值：有返回值才包装
-					idx := strings.Index(trimmed, "(")
-					if idx > 0 && strings.HasSuffix(trimmed, ")") {
-						name := extractFuncChain(trimmed[:idx])
-						if name != "" {
-							if GetCoder().CanPrintFunction(code, name) {
-								indent := strings.Repeat("\t", strings.Count(line, "\t"))
-								lines[i] = indent + "fmt.Println(" + trimmed + ")"
-							} else {
-								// 无返回值：保持原样执行
-								lines[i] = line
-							}
-							continue
-						}
-					}
-					// 无法识别调用名，退回到默认包装策略
+					// 根据返回值判断是否包装，没有返回值时保持原样执行
 					indent := strings.Repeat("\t", strings.Count(line, "\t"))
-					lines[i] = indent + "fmt.Println(" + trimmed + ")"
+					lines[i] = indent + c.autoPrintExpr(code, trimmed, 0)
 				}
 			}
 		}
@@ -663,56 +609,6 @@ func extractFuncChain(s string) string {
 	return ""
 }
 
-// processVariableDeclarations 处理输入代码中的变量声明，将重复声明转换为赋值
-func processVariableDeclarations(input string, existingVars map[string]bool) string {
-	lines := strings.Split(input, "\n")
-	result := make([]string, 0, len(lines))
-
-	// 处理每一行代码
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		// 检查是否是简单的变量声明语句
-		if strings.Contains(trimmed, ":=") && !strings.HasPrefix(trimmed, "_") &&
-			!strings.HasPrefix(trimmed, "func") && !strings.Contains(trimmed, ",") {
-
-			parts := strings.SplitN(trimmed, ":=", 2)
-			if len(parts) == 2 {
-				varName := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-
-				// 检查是否是简单变量名
-				if !strings.Contains(varName, "(") && !strings.Contains(varName, "[") && varName != "" {
-					// 如果变量已存在，将 := 替换为 =
-					if existingVars[varName] {
-						// 保留缩进
-						indent := ""
-						for _, r := range line {
-							if r == '\t' {
-								indent += "\t"
-							} else {
-								break
-							}
-						}
-						result = append(result, indent+varName+" = "+value)
-					} else {
-						// 新变量，保留原样
-						result = append(result, line)
-						// 添加到已存在变量列表
-						existingVars[varName] = true
-					}
-					continue
-				}
-			}
-		}
-
-		// 非变量声明或复杂声明，保留原样
-		result = append(result, line)
-	}
-
-	return strings.Join(result, "\n")
-}
-
 type varEntry struct {
 	name string
 	pos  token.Pos
@@ -757,7 +653,7 @@ func collectSerializeCall(stmt ast.Stmt) *ast.ExprStmt {
 	if !ok {
 		return nil
 	}
-	if fun, ok := call.Fun.(*ast.Ident); !ok || fun.Name != "_Serialize" {
+	if fun, ok := call.Fun.(*ast.Ident); !ok || (fun.Name != "_Serialize" && fun.Name != "_SerializeFunc") {
 		return nil
 	}
 	return exprStmt
@@ -774,6 +670,8 @@ func removeSerializeStmts(stmts []ast.Stmt) []ast.Stmt {
 	return filtered
 }
 
+// 收集 main 函数中可以序列化的变量
+// 只处理 main 函数作用域中的变量，for、if 以及函数字面量等内部作用域中定义的变量不处理
 func collectSerializableVars(body *ast.BlockStmt) []varEntry {
 	// 记录变量的首次出现位置与最后一次赋值表达式
 	firstPos := make(map[string]token.Pos)
@@ -781,13 +679,18 @@ func collectSerializableVars(body *ast.BlockStmt) []varEntry {
 
 	ast.Inspect(body, func(n ast.Node) bool {
 		switch node := n.(type) {
+		case *ast.BlockStmt:
+			return node == body
+		case *ast.FuncLit, *ast.ForStmt, *ast.RangeStmt, *ast.IfStmt,
+			*ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			return false
 		case *ast.AssignStmt:
 			if node.Tok != token.DEFINE && node.Tok != token.ASSIGN {
 				return true
 			}
 			for i, lhs := range node.Lhs {
 				ident, ok := lhs.(*ast.Ident)
-				if !ok || ident.Name == "_" {
+				if !ok || ident.Name == "_" || isOutName(ident.Name) {
 					continue
 				}
 				if i >= len(node.Rhs) {
@@ -806,7 +709,7 @@ func collectSerializableVars(body *ast.BlockStmt) []varEntry {
 		case *ast.ValueSpec:
 			valueCount := len(node.Values)
 			for i, name := range node.Names {
-				if name.Name == "_" {
+				if name.Name == "_" || isOutName(name.Name) {
 					continue
 				}
 				if i >= valueCount {
@@ -839,20 +742,27 @@ func collectSerializableVars(body *ast.BlockStmt) []varEntry {
 	return entries
 }
 
-func makeSerializeCalls(entries []varEntry, existing map[string]struct{}) []ast.Stmt {
+// 生成变量的序列化语句
+// 函数字面量使用 _SerializeFunc，同时记录函数源码，用于下次运行时重建函数
+func makeSerializeCalls(fset *token.FileSet, entries []varEntry, existing map[string]struct{}) []ast.Stmt {
 	var stmts []ast.Stmt
 	for _, entry := range entries {
 		if _, ok := existing[entry.name]; ok {
 			continue
 		}
 		lit := &ast.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("%q", VAR_PREFIX+entry.name)}
-		call := &ast.ExprStmt{
-			X: &ast.CallExpr{
-				Fun:  ast.NewIdent("_Serialize"),
-				Args: []ast.Expr{lit, ast.NewIdent(entry.name)},
-			},
+		call := &ast.CallExpr{
+			Fun:  ast.NewIdent("_Serialize"),
+			Args: []ast.Expr{lit, ast.NewIdent(entry.name)},
 		}
-		stmts = append(stmts, call)
+		if funcLit, ok := entry.expr.(*ast.FuncLit); ok {
+			var buf bytes.Buffer
+			if err := format.Node(&buf, fset, funcLit); err == nil {
+				call.Fun = ast.NewIdent("_SerializeFunc")
+				call.Args = append(call.Args, &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(buf.String())})
+			}
+		}
+		stmts = append(stmts, &ast.ExprStmt{X: call})
 		existing[entry.name] = struct{}{}
 	}
 	return stmts
@@ -1076,29 +986,64 @@ func serializeCallVarName(call *ast.CallExpr) string {
 }
 
 func Command(name string, args ...string) (string, error) {
-	c := exec.Command(name, args...)
-	var out bytes.Buffer
-	var outErr bytes.Buffer
-	c.Stdout = &out
-	c.Stderr = &outErr
-	err := c.Run()
+	return CommandInDir("", nil, name, args...)
+}
 
-	outStr := strings.TrimSpace(out.String())
-	errStr := strings.TrimSpace(outErr.String())
+// 在指定目录中运行命令
+//   - dir: 运行目录，为空时使用当前目录
+//   - env: 追加的环境变量，比如 GOWORK=off
+func CommandInDir(dir string, env []string, name string, args ...string) (string, error) {
+	return CommandContext(context.Background(), dir, env, name, args...)
+}
 
-	if err != nil {
-		if errStr != "" {
-			return outStr, errors.New(errStr)
-		}
-		return outStr, err
+// 在指定目录中运行命令，ctx 取消或超时时结束命令，返回 stdout
+// 命令失败时 stderr 有输出则作为错误返回，成功时 stderr 的输出只记录在 DEBUG 日志中
+func CommandContext(ctx context.Context, dir string, env []string, name string, args ...string) (string, error) {
+	result, err := RunCommand(ctx, dir, env, name, args...)
+	if err == nil && result.Stderr != "" {
+		logger.Debugf("%s stderr: %s", name, result.Stderr)
 	}
+	return result.Stdout, err
+}
 
-	if errStr != "" {
-		// 即使成功，但是 err 有输出，也认为是错误
-		return outStr, errors.New(errStr)
+// 在指定目录中运行命令
+// 功能需求:
+// - 命令在单独的进程组中运行，ctx 取消或超时时包括 go run 启动的程序在内的整个进程组都会被结束
+// - ctx 取消时返回 ErrRunInterrupted，超时时返回 ErrRunTimeout，同时返回已经输出的内容
+// - ctx 中通过 WithOutputFunc 设置了接收函数时，stdout 和 stderr 按行实时输出
+// - ctx 中通过 WithStdin 设置了 stdin 时，命令可以读取输入
+// - 退出码不为 0 时返回错误，stderr 有输出时作为错误内容；退出码为 0 时 stderr 的输出不作为错误
+func RunCommand(ctx context.Context, dir string, env []string, name string, args ...string) (CommandResult, error) {
+	c := exec.CommandContext(ctx, name, args...)
+	c.Dir = dir
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
+	setProcessGroup(c)
+	// 进程组中的其他进程可能还持有输出管道，避免结束后一直等待
+	c.WaitDelay = time.Second
+	cleanup, err := attachStdin(ctx, c)
+	if err != nil {
+		return CommandResult{}, err
 	}
+	defer cleanup()
+	recorder := newOutputRecorder(outputFuncFromContext(ctx), GetRequest().PrintColor)
+	c.Stdout = recorder.writer(false)
+	c.Stderr = recorder.writer(true)
+	err = c.Run()
+	recorder.flush()
+	result := recorder.result()
 
-	return outStr, nil
+	if ctx.Err() != nil {
+		return result, contextRunError(ctx)
+	}
+	if err != nil {
+		if result.Stderr != "" {
+			return result, errors.New(result.Stderr)
+		}
+		return result, err
+	}
+	return result, nil
 }
 
 func SerializeVar[T any](name string, value T) error {
@@ -1,12 +1,14 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"go/format"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"golang.org/x/tools/imports"
 )
@@ -51,9 +53,9 @@ func ImportsInFile(filePath string) (bool, error) {
 	// 第一个参数：传入真实文件名（用于正确解析包路径和导入）
 	// 第二个参数：原始文件内容
 	// 第三个参数：配置项（nil 表示默认配置，可自定义本地包前缀等）
-	fixedContent, err := imports.Process(filePath, content, nil)
+	fixedContent, err := processImports(filePath, content)
 	if err != nil {
-		return false, fmt.Errorf("处理导入失败: %w", err)
+		return false, err
 	}
 
 	// 3. 对比处理前后的内容，避免无意义的写入
@@ -70,11 +72,33 @@ func ImportsInFile(filePath string) (bool, error) {
 	return true, nil
 }
 
+// 对文件内容进行 imports 操作，不写入文件
+// 相同目录中内容相同的文件直接使用编译缓存中的处理结果
+func processImports(filePath string, content []byte) ([]byte, error) {
+	cache := GetCompileCache()
+	key := cache.Key(filepath.Dir(filePath), []byte(filePath), content)
+	if fixed, ok := cache.Imports(key); ok {
+		return fixed, nil
+	}
+	fixed, err := imports.Process(filePath, content, nil)
+	if err != nil {
+		return nil, fmt.Errorf("处理导入失败: %w", err)
+	}
+	cache.SetImports(key, fixed)
+	return fixed, nil
+}
+
 // 运行 main 文件
 // 功能需求:
 // - 对 codePath 进行 imports 操作
-// - go run codePath 时，需要带上同目录下其他的 go 文件
-func RunCode(codePath string) (string, error) {
+// - 运行 codePath 时，需要带上同目录下其他的 go 文件
+// - 具体的运行方式由当前的执行器 GetExecutor 决定
+// - 运行时间超过 SetRunTimeout 设置的超时时间，或者 ctx 取消时结束运行
+//   - 执行器实现了 BuildExecutor 时先编译，超时时间只从运行编译后的程序开始计算
+//   - 其他执行器比如 go run 的超时时间包括编译时间
+//
+// - 通过 SetStdinFile 设置了 stdin 文件时，代码从文件中读取输入
+func RunCode(ctx context.Context, codePath string) (string, error) {
 	// 运行 imports
 	if _, err := ImportsInFile(codePath); err != nil {
 		logger.Errorf("imports failed: %v", err)
@@ -109,18 +133,41 @@ func RunCode(codePath string) (string, error) {
 	}
 
 	sort.Strings(goFiles)
-	args := append([]string{"run", codePath}, goFiles...)
 
 	// 运行代码
-	return Command("go", args...)
+	e := GetExecutor()
+	ctx, closeStdin, err := withStdinFile(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer closeStdin()
+	begin := time.Now()
+	var out string
+	if b, ok := e.(BuildExecutor); ok {
+		binPath, err := b.Build(ctx, codePath, goFiles)
+		if err != nil {
+			return "", err
+		}
+		logger.Infof("执行器 %s 编译耗时: %v", e.Name(), time.Since(begin))
+		begin = time.Now()
+		runCtx, cancel := withRunTimeout(ctx)
+		defer cancel()
+		out, err = runBinary(runCtx, binPath)
+	} else {
+		runCtx, cancel := withRunTimeout(ctx)
+		defer cancel()
+		out, err = e.Run(runCtx, codePath, goFiles)
+	}
+	logger.Infof("执行器 %s 运行耗时: %v", e.Name(), time.Since(begin))
+	return out, err
 }
 
-func WriteAndRunCode(code, codePath string) (string, error) {
+func WriteAndRunCode(ctx context.Context, code, codePath string) (string, error) {
 	// 写入文件
 	err := WriteCode(code, codePath)
 	if err != nil {
 		logger.Errorf("写入临时文件失败: %v\n", err)
 		return "", err
 	}
-	return RunCode(codePath)
+	return RunCode(ctx, codePath)
 }
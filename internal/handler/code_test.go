@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"go/ast"
@@ -100,7 +101,7 @@ func main() {
 	if err != nil {
 		t.Fatalf("JoinPrintCode 返回错误: %v", err)
 	}
-	if strings.Contains(got, "fmt.Println(time.Sleep(0))") {
+	if strings.Contains(got, "_Print(time.Sleep(0))") {
 		t.Fatalf("无返回值的 time.Sleep 不应被打印: %s", got)
 	}
 }
@@ -122,7 +123,7 @@ func main() {
 	if err != nil {
 		t.Fatalf("JoinPrintCode 返回错误: %v", err)
 	}
-	if !strings.Contains(got, "fmt.Println(GetT().Val())") {
+	if !strings.Contains(got, "_Print(GetT().Val())") {
 		t.Fatalf("链式有返回值调用应被打印: %s", got)
 	}
 }
@@ -143,8 +144,8 @@ func main() {
 	if err != nil {
 		t.Fatalf("JoinPrintCode 返回错误: %v", err)
 	}
-	if strings.Contains(got, "fmt.Println(InitX())") {
-		t.Fatalf("无返回值调用不应被 fmt.Println 包裹: %s", got)
+	if strings.Contains(got, "_Print(InitX())") {
+		t.Fatalf("无返回值调用不应被 _Print 包裹: %s", got)
 	}
 	if !strings.Contains(got, "InitX()") {
 		t.Fatalf("应当保留原始调用以顺利执行: %s", got)
@@ -168,8 +169,8 @@ func main() {
 	if !strings.Contains(got, "var name string") {
 		t.Fatalf("应保留 var 定义: %s", got)
 	}
-	if strings.Contains(got, "fmt.Println(") {
-		t.Fatalf("var 定义不应被 fmt.Println 包装: %s", got)
+	if strings.Contains(got, PRINT_FUNC+"(") {
+		t.Fatalf("var 定义不应被 _Print 包装: %s", got)
 	}
 }
 
@@ -379,7 +380,7 @@ func main() {
 }
 `
 
-	out, err := WriteAndRunCode(mainCode, codePath)
+	out, err := WriteAndRunCode(context.Background(), mainCode, codePath)
 	if err != nil {
 		t.Fatalf("WriteAndRunCode 执行失败: %v", err)
 	}
@@ -407,8 +408,8 @@ func main() {
 		t.Fatalf("JoinPrintCode 未移除输入标记: %s", got)
 	}
 
-	if !strings.Contains(got, "fmt.Println(time.Now())") {
-		t.Fatalf("期望输出包含 fmt.Println 包装: %s", got)
+	if !strings.Contains(got, "_Print(time.Now())") {
+		t.Fatalf("期望输出包含 _Print 包装: %s", got)
 	}
 }
 
@@ -427,7 +428,7 @@ func main() {
 		t.Fatalf("JoinPrintCode 返回错误: %v", err)
 	}
 
-	if !strings.Contains(got, "fmt.Println(t)") {
+	if !strings.Contains(got, "_Print(t)") {
 		t.Fatalf("期望标识符被打印: %s", got)
 	}
 }
@@ -472,7 +473,7 @@ func main() {
 	if !strings.Contains(got, "a := 1") {
 		t.Fatalf("赋值语句应当保留: %s", got)
 	}
-	if strings.Contains(got, "fmt.Println(a := 1)") {
+	if strings.Contains(got, "_Print(a := 1)") {
 		t.Fatalf("赋值语句不应被包装: %s", got)
 	}
 }
@@ -496,7 +497,7 @@ func main() {
 	if !strings.Contains(got, "a := time.Now()") {
 		t.Fatalf("应保留赋值语句: %s", got)
 	}
-	if !strings.Contains(got, "fmt.Println(a)") {
+	if !strings.Contains(got, "_Print(a)") {
 		t.Fatalf("应打印最后的表达式: %s", got)
 	}
 }
@@ -518,7 +519,7 @@ func main() {
 	if !strings.Contains(got, "test := func() string { return \"wxnacy\" }") {
 		t.Fatalf("应保留函数定义: %s", got)
 	}
-	if !strings.Contains(got, "fmt.Println(test)") {
+	if !strings.Contains(got, "_Print(test)") {
 		t.Fatalf("应打印函数变量: %s", got)
 	}
 }
@@ -551,3 +552,56 @@ func serializeCallNamesFromCode(t *testing.T, code string) []string {
 	}
 	return names
 }
+
+// 每次输入只执行一次，之前输入中有副作用的语句不会重复执行
+func TestInputAndRunExecutesEachInputOnce(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	path := filepath.Join(t.TempDir(), "count.txt")
+	steps := []struct {
+		input  string
+		expect string
+	}{
+		{"func touch(p string) int {\n\tb, _ := os.ReadFile(p)\n\tos.WriteFile(p, append(b, 'x'), 0o644)\n\treturn len(b) + 1\n}", ""},
+		{`fmt.Println("hello")`, "hello"},
+		{"n := touch(`" + path + "`)", ""},
+		{"counter := func() int { return touch(`" + path + "`) }", ""},
+		{"m := n + 1", ""},
+		{"n", "1"},
+		{"counter()", "2"},
+		{"m", "2"},
+	}
+	for _, step := range steps {
+		if out, err := c.InputAndRun(step.input); err != nil || out != step.expect {
+			t.Fatalf("%q 结果不符合预期: %q %v", step.input, out, err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "xx" {
+		t.Fatalf("touch 应只执行两次: %q", data)
+	}
+}
+
+// 重建代码中只有恢复变量和定义函数变量的代码
+func TestInsertOrJoinCodeReplaysOnlyState(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{
+		VarNames:    []string{"a", "f", "g"},
+		FuncCodeMap: map[string]string{"f": "func() int { return 1 }", "g": "os.Exit(1)"},
+	}
+	if err := SerializeVar(VAR_PREFIX+"a", 1); err != nil {
+		t.Fatal(err)
+	}
+	code := c.InsertOrJoinCode("a")
+	for _, expect := range []string{`a, _ := _Deserialize[int]("var-a")`, "f := func() int { return 1 }"} {
+		if !strings.Contains(code, expect) {
+			t.Fatalf("代码中应包含 %q: %s", expect, code)
+		}
+	}
+	if strings.Contains(code, "os.Exit") {
+		t.Fatalf("不是函数字面量的源码不应拼接到代码中: %s", code)
+	}
+}
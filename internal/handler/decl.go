@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// .type 文件中会话内声明的类型带有 main. 前缀，比如 main.User、[]*main.User
+var mainTypePrefixPattern = regexp.MustCompile(`\bmain\.`)
+
+// 声明代码
+// name 是声明在 DeclCodeMap 中的键
+//   - 类型、函数、常量使用声明的名称，比如 User、add
+//   - 方法使用 接收者类型.方法名，比如 User.Greet
+//   - const、var 块中声明了多个名称时使用逗号拼接，比如 A,B
+type declCode struct {
+	name string
+	code string
+}
+
+// 声明中定义的名称列表
+func declIdents(name string) []string {
+	return strings.Split(name, ",")
+}
+
+// 解析输入中的包级声明和导入
+// 功能需求:
+// - input 只包含包级声明和 import 语句时返回每个声明的名称和格式化后的代码以及导入的包，ok 为 true
+//   - 支持 type、func、方法、const 以及 var ( ... ) 块
+//   - 单独一行的 var 声明仍然作为 main 函数中的语句处理，这样变量的值可以序列化保存，初始化表达式不会被重复执行
+//   - func main 不能作为声明
+//
+// - 同一个 type 块中的多个类型拆分为单独的声明，便于单独替换
+// - const、var 块保持完整，避免 iota 等依赖顺序的声明被拆散
+// - input 中包含其他语句时 ok 为 false，按 main 函数中的语句处理
+func parseDeclInput(input string) ([]declCode, []Import, bool) {
+	input = strings.TrimSpace(strings.Replace(input, INPUT_SUFFIX, "", 1))
+	if input == "" {
+		return nil, nil, false
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", "package main\n"+input, 0)
+	if err != nil || len(file.Decls) == 0 {
+		return nil, nil, false
+	}
+
+	var decls []declCode
+	var imports []Import
+	add := func(name string, node ast.Node) bool {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, node); err != nil {
+			return false
+		}
+		decls = append(decls, declCode{name: name, code: buf.String()})
+		return true
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv == nil && name == "main" {
+				return nil, nil, false
+			}
+			if recv := recvTypeName(d.Recv); recv != "" {
+				name = recv + "." + name
+			}
+			if !add(name, d) {
+				return nil, nil, false
+			}
+		case *ast.GenDecl:
+			switch d.Tok {
+			case token.IMPORT:
+				for _, spec := range d.Specs {
+					imp, ok := importFromSpec(spec.(*ast.ImportSpec))
+					if !ok {
+						return nil, nil, false
+					}
+					imports = append(imports, imp)
+				}
+			case token.TYPE:
+				for _, spec := range d.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					single := &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{typeSpec}}
+					if !add(typeSpec.Name.Name, single) {
+						return nil, nil, false
+					}
+				}
+			case token.CONST, token.VAR:
+				if d.Tok == token.VAR && !d.Lparen.IsValid() {
+					return nil, nil, false
+				}
+				var names []string
+				for _, spec := range d.Specs {
+					for _, ident := range spec.(*ast.ValueSpec).Names {
+						if ident.Name != "_" {
+							names = append(names, ident.Name)
+						}
+					}
+				}
+				if len(names) == 0 || !add(strings.Join(names, ","), d) {
+					return nil, nil, false
+				}
+			default:
+				return nil, nil, false
+			}
+		default:
+			return nil, nil, false
+		}
+	}
+	return decls, imports, true
+}
+
+// 获取方法接收者的类型名称，去掉指针和类型参数
+func recvTypeName(recv *ast.FieldList) string {
+	if recv == nil || len(recv.List) == 0 {
+		return ""
+	}
+	expr := recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// 保存包级声明，同名声明会替换之前的版本，顺序保持首次声明时的位置
+// const、var 块中任意名称被重新声明时，之前的整个块会被删除
+func (c *Coder) putDecls(decls []declCode) {
+	if c.DeclCodeMap == nil {
+		c.DeclCodeMap = make(map[string]string)
+	}
+	for _, decl := range decls {
+		idents := make(map[string]struct{})
+		for _, ident := range declIdents(decl.name) {
+			idents[ident] = struct{}{}
+		}
+		for _, name := range c.DeclNames {
+			if name == decl.name {
+				continue
+			}
+			for _, ident := range declIdents(name) {
+				if _, ok := idents[ident]; ok {
+					c.removeDecl(name)
+					break
+				}
+			}
+		}
+		if _, exist := c.DeclCodeMap[decl.name]; !exist {
+			c.DeclNames = append(c.DeclNames, decl.name)
+		}
+		c.DeclCodeMap[decl.name] = decl.code
+	}
+}
+
+// 删除包级声明
+func (c *Coder) removeDecl(name string) {
+	delete(c.DeclCodeMap, name)
+	filtered := make([]string, 0, len(c.DeclNames))
+	for _, n := range c.DeclNames {
+		if n != name {
+			filtered = append(filtered, n)
+		}
+	}
+	c.DeclNames = filtered
+}
+
+// 拼接包级声明代码
+func (c *Coder) joinDeclCode() string {
+	codes := make([]string, 0, len(c.DeclNames))
+	for _, name := range c.DeclNames {
+		if code, exist := c.DeclCodeMap[name]; exist {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return "\n"
+	}
+	return "\n" + strings.Join(codes, "\n\n") + "\n"
+}
+
+// 本次输入中的包级声明和导入
+// InsertOrJoinCode 只用于生成代码，运行成功后才通过 commitPending 保存到 Coder 中
+// 这样补全时生成代码、运行失败的输入都不会影响后续的输入
+type pendingInput struct {
+	decls   []declCode
+	imports []Import
+}
+
+// 在当前声明和导入的基础上合并本次输入，不修改 Coder
+func (c *Coder) mergePending(pending *pendingInput) *Coder {
+	merged := &Coder{
+		DeclNames:   append([]string(nil), c.DeclNames...),
+		DeclCodeMap: make(map[string]string, len(c.DeclCodeMap)),
+		Imports:     append([]Import(nil), c.Imports...),
+	}
+	for name, code := range c.DeclCodeMap {
+		merged.DeclCodeMap[name] = code
+	}
+	if pending != nil {
+		merged.putDecls(pending.decls)
+		merged.putImports(pending.imports)
+	}
+	return merged
+}
+
+// 保存本次输入中的声明和导入
+func (c *Coder) commitPending() {
+	if c.pending == nil {
+		return
+	}
+	c.putDecls(c.pending.decls)
+	c.putImports(c.pending.imports)
+	c.pending = nil
+}
+
+// 读取变量序列化时保存的类型，并去掉会话内声明类型的 main. 前缀
+func ReadVarType(v string) (string, error) {
+	typeName, err := ReadCode(filepath.Join(GetTempDir(), VAR_PREFIX+v+".type"))
+	if err != nil {
+		return "", err
+	}
+	return mainTypePrefixPattern.ReplaceAllString(typeName, ""), nil
+}
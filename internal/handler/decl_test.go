@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDeclInputType(t *testing.T) {
+	decls, _, ok := parseDeclInput("type ( A int; B struct{ Name string } )" + INPUT_SUFFIX)
+	if !ok {
+		t.Fatal("type 声明应被识别为包级声明")
+	}
+	var names []string
+	for _, decl := range decls {
+		names = append(names, decl.name)
+	}
+	if !reflect.DeepEqual(names, []string{"A", "B"}) {
+		t.Fatalf("声明名称不符合预期: %v", names)
+	}
+	if decls[0].code != "type A int" {
+		t.Fatalf("声明代码不符合预期: %q", decls[0].code)
+	}
+
+	for _, input := range []string{"a := 1", "var a = 1", "func main() {}", "User{}", "fmt.Println(1)", ""} {
+		if _, _, ok := parseDeclInput(input); ok {
+			t.Fatalf("%q 不应识别为包级声明", input)
+		}
+	}
+}
+
+func TestParseDeclInputNames(t *testing.T) {
+	cases := map[string][]string{
+		"func add(a, b int) int { return a + b }":                {"add"},
+		"func (u *User) Greet() string { return u.Name }":        {"User.Greet"},
+		"func (p Pair[K, V]) Key() K { return p.k }":             {"Pair.Key"},
+		"const ( A = iota; B )":                                  {"A,B"},
+		"const Pi = 3.14":                                        {"Pi"},
+		"var ( x = 1; y, _ = 2, 3 )":                             {"x,y"},
+		"type T int; func (t T) String() string { return \"\" }": {"T", "T.String"},
+	}
+	for input, expect := range cases {
+		decls, _, ok := parseDeclInput(input)
+		if !ok {
+			t.Fatalf("%q 应识别为包级声明", input)
+		}
+		var names []string
+		for _, decl := range decls {
+			names = append(names, decl.name)
+		}
+		if !reflect.DeepEqual(names, expect) {
+			t.Fatalf("%q 声明名称期望 %v, 实际 %v", input, expect, names)
+		}
+	}
+}
+
+// 重新声明 const、var 块中的名称时替换整个块
+func TestPutDeclsReplacesBlock(t *testing.T) {
+	c := &Coder{}
+	for _, input := range []string{"const ( A = iota; B )", "func add() {}", "const B = 10"} {
+		decls, _, _ := parseDeclInput(input)
+		c.putDecls(decls)
+	}
+	if !reflect.DeepEqual(c.DeclNames, []string{"add", "B"}) {
+		t.Fatalf("DeclNames 不符合预期: %v", c.DeclNames)
+	}
+	if _, exist := c.DeclCodeMap["A,B"]; exist {
+		t.Fatalf("旧的 const 块应被删除: %v", c.DeclCodeMap)
+	}
+}
+
+// type 声明放在包级，重复声明替换之前的版本
+func TestInsertOrJoinCodeHoistsTypeDecl(t *testing.T) {
+	c := &Coder{}
+	code := c.InsertOrJoinCode("type User struct{ Name string }")
+	if !strings.Contains(code, "package main\n\ntype User struct{ Name string }\n\nfunc main() {") {
+		t.Fatalf("type 声明应放在 main 函数之前: %s", code)
+	}
+	if len(c.DeclNames) != 0 {
+		t.Fatalf("运行成功前不应保存声明: %v", c.DeclNames)
+	}
+	c.commitPending()
+
+	code = c.InsertOrJoinCode("type User struct{ Name, Email string }")
+	if strings.Count(code, "type User") != 1 || !strings.Contains(code, "Name, Email string") {
+		t.Fatalf("重复声明应替换之前的版本: %s", code)
+	}
+	c.commitPending()
+	if !reflect.DeepEqual(c.DeclNames, []string{"User"}) {
+		t.Fatalf("DeclNames 不符合预期: %v", c.DeclNames)
+	}
+}
+
+// 会话内声明的类型可以创建、序列化并在后续输入中使用
+func TestInputAndRunUserDefinedType(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+
+	for _, input := range []string{
+		"type User struct{ Name string; Age int }",
+		`u := User{Name: "wgo", Age: 1}`,
+		"users := []*User{&u}",
+	} {
+		if _, err := c.InputAndRun(input); err != nil {
+			t.Fatalf("运行 %q 返回错误: %v", input, err)
+		}
+	}
+	if typeName, err := ReadVarType("users"); err != nil || typeName != "[]*User" {
+		t.Fatalf("类型应去掉 main. 前缀: %q %v", typeName, err)
+	}
+	if out, err := c.InputAndRun("u.Name"); err != nil || out != "wgo" {
+		t.Fatalf("读取结构体字段结果不符合预期: %q %v", out, err)
+	}
+	if out, err := c.InputAndRun("users[0].Age + 1"); err != nil || out != "2" {
+		t.Fatalf("读取切片中的结构体结果不符合预期: %q %v", out, err)
+	}
+}
+
+// 运行失败时撤销本次输入的声明
+func TestInputAndRunRollbackInvalidDecl(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+
+	if _, err := c.InputAndRun("type Bad struct{ X NotExist }"); err == nil {
+		t.Fatal("错误的类型声明应返回错误")
+	}
+	if _, exist := c.DeclCodeMap["Bad"]; exist || len(c.DeclNames) != 0 {
+		t.Fatalf("错误的声明应被撤销: %v %v", c.DeclNames, c.DeclCodeMap)
+	}
+	if out, err := c.InputAndRun("1 + 1"); err != nil || out != "2" {
+		t.Fatalf("撤销声明后应可以继续运行: %q %v", out, err)
+	}
+}
+
+// 函数、方法、常量声明可以在后续输入中使用，重新定义函数替换之前的版本
+func TestInputAndRunTopLevelDecls(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+
+	for _, input := range []string{
+		"func add(a, b int) int { return a + b }",
+		"type User struct{ Name string }",
+		"func (u User) Greet() string { return \"hi \" + u.Name }",
+		"const ( Zero = iota; One )",
+		"var ( prefix = \">\" )",
+	} {
+		if _, err := c.InputAndRun(input); err != nil {
+			t.Fatalf("运行 %q 返回错误: %v", input, err)
+		}
+	}
+	if out, err := c.InputAndRun("add(One, 2)"); err != nil || out != "3" {
+		t.Fatalf("调用声明的函数结果不符合预期: %q %v", out, err)
+	}
+	if out, err := c.InputAndRun(`prefix + User{Name: "wgo"}.Greet()`); err != nil || out != ">hi wgo" {
+		t.Fatalf("调用声明的方法结果不符合预期: %q %v", out, err)
+	}
+
+	if _, err := c.InputAndRun("func add(a, b int) int { return a * b }"); err != nil {
+		t.Fatalf("重新定义函数返回错误: %v", err)
+	}
+	if out, err := c.InputAndRun("add(3, 4)"); err != nil || out != "12" {
+		t.Fatalf("重新定义后应使用新的函数: %q %v", out, err)
+	}
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	EXECUTOR_RUN   = "run"
+	EXECUTOR_BUILD = "build"
+)
+
+var (
+	executors   = map[string]Executor{}
+	executorsMu sync.RWMutex
+	executor    Executor      // 当前使用的执行器，读写时需要持有 executorsMu
+	runTimeout  time.Duration // 运行代码的超时时间，为 0 时不限制
+)
+
+// 代码执行器
+// 负责运行 main 文件以及同目录下的其他 go 文件，返回值的语义和 RunCommand 保持一致
+//   - 运行成功时返回按照输出顺序合并的 stdout 和 stderr，失败时 stderr 作为错误返回
+//   - ctx 取消或超时时需要结束运行，并返回 ErrRunInterrupted 或 ErrRunTimeout
+//   - ctx 中有 WithOutputFunc 设置的接收函数时实时输出，有 WithStdin 设置的 stdin 时传给运行的代码
+//
+// 可以通过 RegisterExecutor 注册其他实现，比如解释器、远程或沙箱运行
+type Executor interface {
+	// 执行器名称，用于命令行参数选择
+	Name() string
+	// 运行代码
+	//   - codePath: main 文件地址
+	//   - files: 同目录下需要一起编译的其他 go 文件
+	Run(ctx context.Context, codePath string, files []string) (string, error)
+}
+
+// 先编译再运行的执行器
+// 实现该接口时 RunCode 先调用 Build 编译，再运行编译后的程序，超时时间只作用于运行阶段，编译耗时不计入超时
+type BuildExecutor interface {
+	Executor
+	// 编译代码，返回可执行文件地址，参数和 Run 相同
+	Build(ctx context.Context, codePath string, files []string) (string, error)
+}
+
+func init() {
+	RegisterExecutor(&goRunExecutor{})
+	RegisterExecutor(&goBuildExecutor{})
+}
+
+// 注册执行器，同名执行器会被覆盖
+func RegisterExecutor(e Executor) {
+	executorsMu.Lock()
+	defer executorsMu.Unlock()
+	executors[e.Name()] = e
+}
+
+// 获取已注册的执行器名称列表
+func ExecutorNames() []string {
+	executorsMu.RLock()
+	defer executorsMu.RUnlock()
+	names := make([]string, 0, len(executors))
+	for name := range executors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 获取当前使用的执行器，没有设置时默认使用 go run
+func GetExecutor() Executor {
+	executorsMu.RLock()
+	defer executorsMu.RUnlock()
+	if executor == nil {
+		return executors[EXECUTOR_RUN]
+	}
+	return executor
+}
+
+// 通过名称设置当前使用的执行器
+func SetExecutor(name string) error {
+	executorsMu.Lock()
+	e, ok := executors[name]
+	if ok {
+		executor = e
+	}
+	executorsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("执行器 %s 不存在，可选: %v", name, ExecutorNames())
+	}
+	logger.Infof("使用执行器 %s", name)
+	return nil
+}
+
+// 设置运行代码的超时时间，为 0 时不限制
+func SetRunTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("超时时间 %v 不能小于 0", timeout)
+	}
+	runTimeout = timeout
+	if timeout > 0 {
+		logger.Infof("运行超时时间 %v", timeout)
+	}
+	return nil
+}
+
+// 获取运行代码的超时时间
+func GetRunTimeout() time.Duration {
+	return runTimeout
+}
+
+// 为运行代码的 ctx 加上超时时间
+func withRunTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if runTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, runTimeout, fmt.Errorf("%w，超过 %v", ErrRunTimeout, runTimeout))
+}
+
+// ctx 结束时运行代码返回的错误
+// 主动取消，比如按下 Ctrl+C 时返回 ErrRunInterrupted，超时返回 ErrRunTimeout
+func contextRunError(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	switch {
+	case cause == nil:
+		return nil
+	case errors.Is(cause, ErrRunTimeout):
+		return cause
+	case errors.Is(cause, context.DeadlineExceeded):
+		return ErrRunTimeout
+	default:
+		return ErrRunInterrupted
+	}
+}
+
+// 使用 go run 运行代码
+type goRunExecutor struct{}
+
+func (e *goRunExecutor) Name() string {
+	return EXECUTOR_RUN
+}
+
+func (e *goRunExecutor) Run(ctx context.Context, codePath string, files []string) (string, error) {
+	args := append([]string{"run", codePath}, files...)
+	dir, env := goCommandDir(filepath.Dir(codePath))
+	result, err := RunCommand(ctx, dir, env, "go", args...)
+	if err != nil {
+		return result.Stdout, err
+	}
+	return result.Output, nil
+}
+
+// 使用 go build 编译后运行二进制文件
+// 二进制文件保存在编译缓存中，源码和模块都没有变化时直接运行之前编译的二进制文件
+type goBuildExecutor struct {
+	cache *CompileCache // 为空时使用 GetCompileCache
+}
+
+func (e *goBuildExecutor) Name() string {
+	return EXECUTOR_BUILD
+}
+
+func (e *goBuildExecutor) Build(ctx context.Context, codePath string, files []string) (string, error) {
+	cache := e.cache
+	if cache == nil {
+		cache = GetCompileCache()
+	}
+	// 编译时不实时输出，也不读取 stdin
+	return cache.Build(WithStdin(WithOutputFunc(ctx, nil), nil), codePath, files)
+}
+
+func (e *goBuildExecutor) Run(ctx context.Context, codePath string, files []string) (string, error) {
+	binPath, err := e.Build(ctx, codePath, files)
+	if err != nil {
+		return "", err
+	}
+	return runBinary(ctx, binPath)
+}
+
+// 运行编译后的程序
+func runBinary(ctx context.Context, binPath string) (string, error) {
+	result, err := RunCommand(ctx, "", nil, binPath)
+	if err != nil {
+		return result.Stdout, err
+	}
+	return result.Output, nil
+}
+
+// 计算文件内容的哈希值
+func hashFiles(paths []string) (string, error) {
+	h := sha256.New()
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return "", fmt.Errorf("读取文件失败: %w", err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.Base(p), len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
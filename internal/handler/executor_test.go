@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExecutorNames(t *testing.T) {
+	names := ExecutorNames()
+	for _, name := range []string{EXECUTOR_BUILD, EXECUTOR_RUN} {
+		found := false
+		for _, n := range names {
+			if n == name {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("执行器 %s 未注册: %v", name, names)
+		}
+	}
+}
+
+func TestSetExecutorUnknown(t *testing.T) {
+	if err := SetExecutor("not-exist"); err == nil {
+		t.Fatal("不存在的执行器应返回错误")
+	}
+	if GetExecutor().Name() != EXECUTOR_RUN {
+		t.Fatalf("默认执行器应为 %s，实际: %s", EXECUTOR_RUN, GetExecutor().Name())
+	}
+}
+
+// 并发设置和获取执行器，使用 -race 运行时不应出现数据竞争
+func TestSetExecutorConcurrent(t *testing.T) {
+	defer SetExecutor(EXECUTOR_RUN)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			name := EXECUTOR_RUN
+			if i%2 == 0 {
+				name = EXECUTOR_BUILD
+			}
+			if err := SetExecutor(name); err != nil {
+				t.Errorf("SetExecutor 返回错误: %v", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if GetExecutor() == nil {
+				t.Error("GetExecutor 不应返回 nil")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+type fakeExecutor struct {
+	codePath string
+	files    []string
+}
+
+func (e *fakeExecutor) Name() string { return "fake" }
+
+func (e *fakeExecutor) Run(ctx context.Context, codePath string, files []string) (string, error) {
+	e.codePath = codePath
+	e.files = files
+	return "fake out", nil
+}
+
+// RunCode 使用当前执行器运行，并传入同目录下的其他 go 文件
+func TestRunCodeUsesRegisteredExecutor(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.go")
+	if err := WriteCode("package main\n\nfunc main() {}\n", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCode("package main\n", filepath.Join(dir, "request.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeExecutor{}
+	RegisterExecutor(fake)
+	defer SetExecutor(EXECUTOR_RUN)
+	if err := SetExecutor("fake"); err != nil {
+		t.Fatalf("SetExecutor 返回错误: %v", err)
+	}
+
+	out, err := RunCode(context.Background(), mainFile)
+	if err != nil || out != "fake out" {
+		t.Fatalf("RunCode 结果不符合预期: %q %v", out, err)
+	}
+	if fake.codePath != mainFile {
+		t.Fatalf("codePath 不符合预期: %s", fake.codePath)
+	}
+	if !reflect.DeepEqual(fake.files, []string{filepath.Join(dir, "request.go")}) {
+		t.Fatalf("files 不符合预期: %v", fake.files)
+	}
+}
+
+// go build 执行器在源码不变时复用二进制文件
+func TestGoBuildExecutorReusesBinary(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.go")
+	code := "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(%s) }\n"
+	if err := WriteCode(fmt.Sprintf(code, "1"), mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newCompileCache(t.TempDir())
+	e := &goBuildExecutor{cache: cache}
+	out, err := e.Run(context.Background(), mainFile, nil)
+	if err != nil || out != "1" {
+		t.Fatalf("第一次运行结果不符合预期: %q %v", out, err)
+	}
+	binPath, err := cache.Build(context.Background(), mainFile, nil)
+	if err != nil {
+		t.Fatalf("Build 返回错误: %v", err)
+	}
+	first, err := os.Stat(binPath)
+	if err != nil {
+		t.Fatalf("二进制文件不存在: %v", err)
+	}
+
+	if out, err := e.Run(context.Background(), mainFile, nil); err != nil || out != "1" {
+		t.Fatalf("第二次运行结果不符合预期: %q %v", out, err)
+	}
+	second, _ := os.Stat(binPath)
+	if !os.SameFile(first, second) {
+		t.Fatal("源码未变化时不应重新编译")
+	}
+	if stats := cache.Stats()[CACHE_KIND_BINARY]; stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("缓存统计不符合预期: %+v", stats)
+	}
+
+	if err := WriteCode(fmt.Sprintf(code, "2"), mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := e.Run(context.Background(), mainFile, nil); err != nil || out != "2" {
+		t.Fatalf("源码变化后应重新编译: %q %v", out, err)
+	}
+}
+
+// 超过超时时间时结束运行，本次输入不影响之后的输入
+func TestInputAndRunTimeout(t *testing.T) {
+	prepareTestWorkspace(t)
+	if err := SetRunTimeout(3 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetRunTimeout(0) })
+	c := &Coder{}
+	begin := time.Now()
+	_, err := c.InputAndRun("time.Sleep(time.Hour)")
+	if !errors.Is(err, ErrRunTimeout) {
+		t.Fatalf("应返回超时错误: %v", err)
+	}
+	if cost := time.Since(begin); cost > 10*time.Second {
+		t.Fatalf("超时后应及时返回: %v", cost)
+	}
+	if out, err := c.InputAndRun("1 + 1"); err != nil || out != "2" {
+		t.Fatalf("超时后应可以继续运行: %q %v", out, err)
+	}
+	if err := SetRunTimeout(-time.Second); err == nil {
+		t.Fatal("超时时间小于 0 时应返回错误")
+	}
+}
+
+type slowBuildExecutor struct {
+	delay   time.Duration
+	binPath string
+}
+
+func (e *slowBuildExecutor) Name() string { return "slow-build" }
+
+func (e *slowBuildExecutor) Build(ctx context.Context, codePath string, files []string) (string, error) {
+	time.Sleep(e.delay)
+	return e.binPath, nil
+}
+
+func (e *slowBuildExecutor) Run(ctx context.Context, codePath string, files []string) (string, error) {
+	return "", errors.New("RunCode 应分开调用 Build 并运行编译后的程序")
+}
+
+// 先编译再运行的执行器，编译时间不计入超时时间
+func TestRunCodeTimeoutExcludesBuild(t *testing.T) {
+	binPath, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("没有找到 true 命令")
+	}
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.go")
+	if err := WriteCode("package main\n\nfunc main() {}\n", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterExecutor(&slowBuildExecutor{delay: 1500 * time.Millisecond, binPath: binPath})
+	defer SetExecutor(EXECUTOR_RUN)
+	if err := SetExecutor("slow-build"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRunTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetRunTimeout(0) })
+
+	if _, err := RunCode(context.Background(), mainFile); err != nil {
+		t.Fatalf("编译时间超过超时时间不应导致超时: %v", err)
+	}
+}
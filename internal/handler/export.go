@@ -0,0 +1,429 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	EXPORT_MAIN    = "main"    // 导出为 main 函数
+	EXPORT_EXAMPLE = "example" // 导出为 _test.go 中的 Example 函数
+)
+
+// 导出的代码中 main 函数或者 Example 函数的模板
+const EXPORT_CODE_TPL = `package %s
+%s
+func %s() {
+	%s
+}`
+
+// 导出时改写的语句
+type exportEdit struct {
+	start, end int // 在输入中的偏移量
+	text       string
+}
+
+// 导出时需要分析返回值的语句
+type exportStmt struct {
+	cell       int    // 所在输入的下标
+	start, end int    // 在输入中的偏移量
+	expr       string // 需要分析的表达式，赋值语句为右边的调用
+	out        int    // 保存为输出结果的编号，被之后的输入引用时大于 0
+	assign     string // v := f() 形式的赋值语句左边的变量
+	redecl     bool   // 赋值语句左边的变量是否已经声明
+	errDecl    bool   // 语句之前是否已经声明了 err
+}
+
+// 将会话导出为独立的 Go 代码
+// 功能需求:
+// - format 为 EXPORT_MAIN 时导出为 main 函数，为 EXPORT_EXAMPLE 时导出为 Example 函数，用于 _test.go 文件
+// - 只导出运行成功的输入，包级声明和导入使用最终的版本
+// - 不包含 _Serialize、_Deserialize 等恢复变量的代码和 // :INPUT 标记，每个输入只出现一次
+// - 输入中的 _、__、Out[n] 改写为 _n，被之后的输入引用的输出结果保存为变量 _n
+// - 自动打印改写为 fmt.Println，通过 AnalyzeExprs 判断返回值
+//   - 有返回值的表达式，比如 user.Name => fmt.Println(user.Name)
+//   - 只返回 error 的调用，比如 os.Remove(p) => if err := os.Remove(p); err != nil { fmt.Println(err) }
+//   - 返回 (T, error) 的调用，成功时打印值，否则打印错误
+//   - v := f() 改写为 v, err := f()，出错时打印错误
+//
+// - 重复声明的变量将 := 改写为 =，没有使用的变量追加 _ = v，保证代码可以编译
+// - 通过 goimports 补全导入并格式化
+// - Example 函数末尾添加 // Output: 注释，内容为导出的输入运行时记录的输出，没有输出时不添加
+// - 会话模式下没有输入记录，不支持导出
+func (c *Coder) Export(format string) (string, error) {
+	return c.export(format, "main", "")
+}
+
+// 导出会话到文件
+// 功能需求:
+// - 文件名以 _test.go 结尾时导出为 Example 函数，包名和目录中其他文件相同，否则导出为 main 函数
+// - 目录中其他测试文件已经有 Example 函数时，使用 Example_wgo、Example_wgo2 等不重复的名称
+// - 文件已经存在时覆盖
+func (c *Coder) ExportFile(path string) error {
+	format, pkg, example := EXPORT_MAIN, "main", ""
+	if strings.HasSuffix(path, "_test.go") {
+		format = EXPORT_EXAMPLE
+		if name := packageNameInDir(filepath.Dir(path)); name != "" {
+			pkg = name
+		}
+		example = exampleNameInDir(filepath.Dir(path), filepath.Base(path))
+	}
+	code, err := c.export(format, pkg, example)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+		return fmt.Errorf("写入导出文件失败: %w", err)
+	}
+	logger.Infof("导出会话到 %s", path)
+	return nil
+}
+
+// example 为 Example 函数的名称，为空时使用 Example
+func (c *Coder) export(format, pkg, example string) (string, error) {
+	if c.session != nil {
+		return "", errSessionUnsupported
+	}
+	funcName := "main"
+	switch format {
+	case EXPORT_MAIN:
+	case EXPORT_EXAMPLE:
+		funcName = "Example"
+		if example != "" {
+			funcName = example
+		}
+	default:
+		return "", fmt.Errorf("不支持的导出格式 %s，可选: %s, %s", format, EXPORT_MAIN, EXPORT_EXAMPLE)
+	}
+
+	inputs, nums := c.exportInputs()
+	if len(inputs) == 0 && len(c.DeclNames) == 0 {
+		return "", errors.New("没有可以导出的输入")
+	}
+	body := c.exportBody(inputs, nums)
+	if format == EXPORT_EXAMPLE {
+		body += c.exportOutputComment(nums)
+	}
+	code := fmt.Sprintf(EXPORT_CODE_TPL, pkg, c.joinDeclCode(), funcName, body)
+	imports := append(append([]Import(nil), c.Imports...), ProjectImports(code, c.Imports)...)
+	if importCode := joinImportCode(imports, nil, code); importCode != "" {
+		code = strings.Replace(code, "package "+pkg+"\n", "package "+pkg+"\n"+importCode, 1)
+	}
+	// 在会话目录中处理导入，可以使用会话中添加的依赖
+	fixed, err := processImports(GetMainFile(), []byte(code))
+	if err != nil {
+		return "", err
+	}
+	return FormatCode(string(fixed))
+}
+
+// 目录中没有使用的 Example 函数名称，依次尝试 Example、Example_wgo、Example_wgo2 等
+// skip 是将被覆盖的文件，其中的函数不算在内
+func exampleNameInDir(dir, skip string) string {
+	used := make(map[string]struct{})
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == skip || !strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				used[fn.Name.Name] = struct{}{}
+			}
+		}
+	}
+	name := "Example"
+	for i := 1; ; i++ {
+		if _, ok := used[name]; !ok {
+			return name
+		}
+		name = "Example_wgo"
+		if i > 1 {
+			name += strconv.Itoa(i)
+		}
+	}
+}
+
+// Example 函数的 // Output: 注释，内容为导出的输入运行时记录的输出，没有输出时返回空字符串
+func (c *Coder) exportOutputComment(nums []int) string {
+	exported := make(map[int]struct{}, len(nums))
+	for _, num := range nums {
+		exported[num] = struct{}{}
+	}
+	var lines []string
+	for _, cell := range c.Cells {
+		if _, ok := exported[cell.Num]; !ok || strings.TrimSpace(cell.Output) == "" {
+			continue
+		}
+		lines = append(lines, strings.Split(strings.TrimRight(cell.Output, "\n"), "\n")...)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n// Output:")
+	for _, line := range lines {
+		b.WriteString("\n//")
+		if line = strings.TrimRight(line, " \t"); line != "" {
+			b.WriteString(" " + line)
+		}
+	}
+	return b.String()
+}
+
+// 运行成功的输入，改写对输出结果的引用，不包括包级声明和导入
+func (c *Coder) exportInputs() ([]string, []int) {
+	var inputs []string
+	var nums []int
+	for i, cell := range c.Cells {
+		if cell.Error != "" && !isIgnoredRunError(cell.Error) {
+			continue
+		}
+		if _, _, ok := parseDeclInput(cell.Input); ok {
+			continue
+		}
+		prev := &Coder{Cells: c.Cells[:i]}
+		inputs = append(inputs, collapseLastExpr(prev.rewriteOutRefs(cell.Input)))
+		nums = append(nums, cell.Num)
+	}
+	return inputs, nums
+}
+
+// 拼接导出的函数体
+func (c *Coder) exportBody(inputs []string, nums []int) string {
+	referenced := make(map[int]struct{})
+	for _, input := range inputs {
+		for _, name := range identNames(input) {
+			if matches := outNamePattern.FindStringSubmatch(name); matches != nil {
+				var num int
+				fmt.Sscan(matches[1], &num)
+				if c.hasOut(num) {
+					referenced[num] = struct{}{}
+				}
+			}
+		}
+	}
+
+	const prefix = "package main\nfunc _() {\n"
+	var stmts []exportStmt
+	declared := make(map[string]struct{})
+	assigned := make(map[string]int) // 作为赋值目标出现的次数
+	var order []string               // 按声明顺序排列的变量
+	edits := make([][]exportEdit, len(inputs))
+	declare := func(name string) {
+		if name == "_" {
+			return
+		}
+		assigned[name]++
+		if _, ok := declared[name]; !ok {
+			declared[name] = struct{}{}
+			order = append(order, name)
+		}
+	}
+
+	for i, input := range inputs {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "", prefix+input+"\n}", 0)
+		if err != nil {
+			continue
+		}
+		offset := func(pos token.Pos) int {
+			return fset.Position(pos).Offset - len(prefix)
+		}
+		list := file.Decls[0].(*ast.FuncDecl).Body.List
+		for j, stmt := range list {
+			switch s := stmt.(type) {
+			case *ast.ExprStmt:
+				item := exportStmt{cell: i, start: offset(s.Pos()), end: offset(s.End())}
+				item.expr = input[item.start:item.end]
+				if _, ok := referenced[nums[i]]; ok && j == len(list)-1 && c.hasOut(nums[i]) {
+					item.out = nums[i]
+					declare(fmt.Sprintf("_%d", nums[i]))
+				}
+				stmts = append(stmts, item)
+			case *ast.AssignStmt:
+				var lhs []string
+				for _, expr := range s.Lhs {
+					if ident, ok := expr.(*ast.Ident); ok {
+						lhs = append(lhs, ident.Name)
+					}
+				}
+				redeclared := s.Tok == token.DEFINE && len(lhs) == len(s.Lhs)
+				for _, name := range lhs {
+					if _, ok := declared[name]; !ok && name != "_" {
+						redeclared = false
+					}
+				}
+				if redeclared {
+					// 之前的输入中已经声明过，改为赋值
+					pos := offset(s.TokPos)
+					edits[i] = append(edits[i], exportEdit{pos, pos + 2, "="})
+				}
+				_, isCall := ast.Unparen(s.Rhs[0]).(*ast.CallExpr)
+				if s.Tok == token.DEFINE && len(lhs) == 1 && len(s.Rhs) == 1 && isCall && lhs[0] != "err" && lhs[0] != "_" {
+					_, errDecl := declared["err"]
+					item := exportStmt{cell: i, start: offset(s.Pos()), end: offset(s.End()), assign: lhs[0], redecl: redeclared, errDecl: errDecl}
+					item.expr = input[offset(s.Rhs[0].Pos()):offset(s.Rhs[0].End())]
+					stmts = append(stmts, item)
+				}
+				for _, name := range lhs {
+					declare(name)
+				}
+			case *ast.DeclStmt:
+				if gen, ok := s.Decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+					for _, spec := range gen.Specs {
+						for _, name := range spec.(*ast.ValueSpec).Names {
+							declare(name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	results := make([]ExprResult, len(stmts))
+	if len(stmts) > 0 {
+		exprs := make([]string, 0, len(stmts))
+		for _, stmt := range stmts {
+			exprs = append(exprs, stmt.expr)
+		}
+		probe := fmt.Sprintf(DEFAULT_CODE_TPL, c.joinDeclCode(), c.exportProbeBody(inputs, referenced))
+		if importCode := joinImportCode(c.Imports, nil, probe); importCode != "" {
+			probe = strings.Replace(probe, "package main\n", "package main\n"+importCode, 1)
+		}
+		if analyzed, err := c.AnalyzeExprs(probe, exprs...); err == nil {
+			results = analyzed
+		} else {
+			logger.Debugf("分析导出的代码失败: %v", err)
+		}
+	}
+	errDecl := false // 改写后的语句中是否已经声明了 err
+	for i, stmt := range stmts {
+		text, ok := exportStmtCode(stmt, results[i], errDecl || stmt.errDecl)
+		if ok {
+			edits[stmt.cell] = append(edits[stmt.cell], exportEdit{stmt.start, stmt.end, text})
+			errDecl = errDecl || strings.Contains(text, ", err :=")
+		}
+	}
+
+	lines := make([]string, 0, len(inputs))
+	for i, input := range inputs {
+		sort.Slice(edits[i], func(a, b int) bool {
+			return edits[i][a].start > edits[i][b].start
+		})
+		for _, edit := range edits[i] {
+			// 改写整条语句时会包含 := 的位置，只保留整条语句的改写
+			if edit.text == "=" && containsEdit(edits[i], edit) {
+				continue
+			}
+			input = input[:edit.start] + edit.text + input[edit.end:]
+		}
+		lines = append(lines, strings.TrimSpace(input))
+	}
+
+	// 没有使用的变量无法编译
+	used := make(map[string]int)
+	for _, name := range identNames(strings.Join(lines, "\n")) {
+		used[name]++
+	}
+	for _, name := range order {
+		if used[name] <= assigned[name] {
+			lines = append(lines, "_ = "+name)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 用于类型检查的函数体，被引用的输出结果按照保存时的类型声明
+func (c *Coder) exportProbeBody(inputs []string, referenced map[int]struct{}) string {
+	var lines []string
+	for num := range referenced {
+		if typeName, err := ReadOutType(num); err == nil {
+			lines = append(lines, fmt.Sprintf("var _%d %s", num, typeName))
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(append(lines, inputs...), "\n")
+}
+
+// 拼接改写后的语句，不需要改写时返回 false
+// errDecl 为 true 时 err 已经声明，v 也已经声明时使用 = 赋值
+func exportStmtCode(stmt exportStmt, result ExprResult, errDecl bool) (string, bool) {
+	if stmt.assign != "" {
+		if !result.IsValueError() {
+			return "", false
+		}
+		tok := ":="
+		if stmt.redecl && errDecl {
+			tok = "="
+		}
+		return fmt.Sprintf("%s, err %s %s\nif err != nil {\nfmt.Println(err)\n}", stmt.assign, tok, stmt.expr), true
+	}
+
+	parsed, err := parser.ParseExpr(stmt.expr)
+	if err != nil {
+		return "", false
+	}
+	_, isCall := ast.Unparen(parsed).(*ast.CallExpr)
+	if isCall {
+		switch {
+		case result.Kind == RESULT_ERROR:
+			return fmt.Sprintf("if err := %s; err != nil {\nfmt.Println(err)\n}", stmt.expr), true
+		case result.IsValueError() && stmt.out > 0:
+			return fmt.Sprintf("_%d, err := %s\nif err != nil {\nfmt.Println(err)\n} else {\nfmt.Println(_%d)\n}", stmt.out, stmt.expr, stmt.out), true
+		case result.IsValueError():
+			return fmt.Sprintf("if v, err := %s; err != nil {\nfmt.Println(err)\n} else {\nfmt.Println(v)\n}", stmt.expr), true
+		case result.Kind == RESULT_MULTI && stmt.out == 0:
+			return fmt.Sprintf("fmt.Println(%s)", stmt.expr), true
+		case result.Kind != RESULT_VALUE:
+			// 没有返回值或者无法判断时保持不变
+			return "", false
+		}
+	}
+	if stmt.out > 0 {
+		return fmt.Sprintf("_%d := %s\nfmt.Println(_%d)", stmt.out, stmt.expr, stmt.out), true
+	}
+	return fmt.Sprintf("fmt.Println(%s)", stmt.expr), true
+}
+
+// 是否有其他改写包含 edit 的位置
+func containsEdit(edits []exportEdit, edit exportEdit) bool {
+	for _, other := range edits {
+		if other != edit && other.start <= edit.start && edit.end <= other.end {
+			return true
+		}
+	}
+	return false
+}
+
+// 代码中出现的标识符，按出现顺序排列
+func identNames(code string) []string {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", fset.Base(), len(code)), []byte(code), nil, 0)
+	var names []string
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.IDENT {
+			names = append(names, lit)
+		}
+	}
+	return names
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 导出的代码去掉会话中生成的代码，可以直接运行
+func TestExport(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+	inputs := []string{
+		`import str "strings"`,
+		`type User struct{ Name string }`,
+		`user := User{Name: "wgo"}`,
+		`str.ToUpper(user.Name)`,
+		`undefinedVar + 1`,
+		`n := strconv.Atoi("7")`,
+		"os.Remove(`" + missing + "`)",
+		`Out[4] + "!"`,
+		`user := User{Name: "go"}`,
+		`total := 0
+for i := 1; i <= 3; i++ {
+	total += i
+}
+total`,
+	}
+	for _, input := range inputs {
+		c.InputAndRun(input)
+	}
+
+	code, err := c.Export(EXPORT_MAIN)
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	for _, generated := range []string{"_Serialize", "_Deserialize", INPUT_SUFFIX, PRINT_FUNC, "undefinedVar"} {
+		if strings.Contains(code, generated) {
+			t.Fatalf("导出的代码中不应包含 %s:\n%s", generated, code)
+		}
+	}
+	for _, expect := range []string{`str "strings"`, "type User struct", "_4 := str.ToUpper(user.Name)", "n, err := strconv.Atoi(\"7\")", "user = User{"} {
+		if !strings.Contains(code, expect) {
+			t.Fatalf("导出的代码中没有 %s:\n%s", expect, code)
+		}
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := WriteCode(code, path); err != nil {
+		t.Fatal(err)
+	}
+	out, err := CommandInDir(dir, nil, "go", "run", "main.go")
+	if err != nil {
+		t.Fatalf("导出的代码运行失败: %v\n%s", err, code)
+	}
+	expect := "WGO\nremove " + missing + ": no such file or directory\nWGO!\n6"
+	if out != expect {
+		t.Fatalf("导出的代码输出不符合预期: %q\n%s", out, code)
+	}
+
+	example, err := c.Export(EXPORT_EXAMPLE)
+	if err != nil || !strings.Contains(example, "func Example() {") || strings.Contains(example, "func main()") {
+		t.Fatalf("导出 Example 失败: %v\n%s", err, example)
+	}
+	if _, err := c.Export("html"); err == nil {
+		t.Fatal("不支持的格式应返回错误")
+	}
+}
+
+// 导出到 _test.go 文件时使用 Example 函数和目录中的包名
+func TestExportFile(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	if _, err := c.InputAndRun(`strings.Repeat("a", 3)`); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := WriteCode("package tools\n", filepath.Join(dir, "tools.go")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "example_test.go")
+	if err := c.ExportFile(path); err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(data)
+	if !strings.HasPrefix(code, "package tools\n") || !strings.Contains(code, `fmt.Println(strings.Repeat("a", 3))`) {
+		t.Fatalf("导出的文件不符合预期:\n%s", code)
+	}
+	if !strings.Contains(code, "func Example() {") || !strings.Contains(code, "\t// Output:\n\t// aaa\n}") {
+		t.Fatalf("导出的 Example 没有 // Output: 注释:\n%s", code)
+	}
+
+	// 其他测试文件中已经有 Example 函数时使用不重复的名称，覆盖的文件中的函数不算在内
+	if err := WriteCode("package tools\n\nfunc Example() {}\n\nfunc Example_wgo() {}\n", filepath.Join(dir, "other_test.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ExportFile(path); err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	if data, err = os.ReadFile(path); err != nil || !strings.Contains(string(data), "func Example_wgo2() {") {
+		t.Fatalf("Example 函数名称重复: %v\n%s", err, data)
+	}
+	if out, err := CommandInDir(dir, nil, "go", "test", "-run", "Example", "tools.go", "other_test.go", "example_test.go"); err != nil {
+		t.Fatalf("导出的 Example 测试失败: %v\n%s", err, out)
+	}
+}
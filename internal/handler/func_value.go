@@ -0,0 +1,340 @@
+package handler
+
+import (
+	"encoding/gob"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 和 BuiltinFuncCode 中 functionRecord 的字段保持一致，用于读取函数变量的序列化记录
+type funcRecord struct {
+	Name   string
+	Source string
+}
+
+// 读取函数变量的序列化记录
+func ReadFuncRecord(name string) (funcRecord, error) {
+	var record funcRecord
+	file, err := os.Open(filepath.Join(GetTempDir(), name))
+	if err != nil {
+		return record, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	if err := gob.NewDecoder(file).Decode(&record); err != nil {
+		return record, fmt.Errorf("decode function record: %w", err)
+	}
+	return record, nil
+}
+
+// 获取变量对应的函数源码
+// 优先使用 FuncCodeMap，没有时从序列化记录中读取并回填到 FuncCodeMap
+// 源码必须是函数字面量，重建时只定义函数不会执行，其他代码视为没有源码
+func (c *Coder) lookupFuncCode(v string) (string, bool) {
+	if funcCode, exist := c.FuncCodeMap[v]; exist {
+		return funcCode, isFuncLitSource(funcCode)
+	}
+	typeName, err := ReadVarType(v)
+	if err != nil || !strings.HasPrefix(typeName, "func") {
+		return "", false
+	}
+	record, err := ReadFuncRecord(VAR_PREFIX + v)
+	if err != nil || !isFuncLitSource(record.Source) {
+		return "", false
+	}
+	if c.FuncCodeMap == nil {
+		c.FuncCodeMap = make(map[string]string)
+	}
+	c.FuncCodeMap[v] = record.Source
+	return record.Source, true
+}
+
+// 源码是否是一个函数字面量，比如 func() int { return 1 }
+func isFuncLitSource(source string) bool {
+	expr, err := parser.ParseExpr(source)
+	if err != nil {
+		return false
+	}
+	_, ok := expr.(*ast.FuncLit)
+	return ok
+}
+
+// 拼接函数变量的重建代码
+// 函数引用自身时（递归），先声明变量再赋值，否则直接使用 := 定义
+func funcReplayLine(v, funcCode string) string {
+	for _, name := range funcSourceFreeVars(funcCode, map[string]struct{}{v: {}}) {
+		if name != v {
+			continue
+		}
+		typeName, err := ReadVarType(v)
+		if err != nil {
+			break
+		}
+		return fmt.Sprintf("var %s %s\n%s = %s", v, typeName, v, funcCode)
+	}
+	return fmt.Sprintf("%s := %s", v, funcCode)
+}
+
+// 调整重建变量的顺序
+// 普通变量保持原有顺序放在前面，函数变量放在后面，并保证函数闭包引用的其他函数变量先定义
+func orderReplayVars(names []string, funcCodes map[string]string) []string {
+	ordered := make([]string, 0, len(names))
+	var funcs []string
+	for _, name := range names {
+		if _, ok := funcCodes[name]; ok {
+			funcs = append(funcs, name)
+			continue
+		}
+		ordered = append(ordered, name)
+	}
+
+	funcSet := make(map[string]struct{}, len(funcs))
+	for _, name := range funcs {
+		funcSet[name] = struct{}{}
+	}
+	deps := make(map[string][]string, len(funcs))
+	for _, name := range funcs {
+		for _, dep := range funcSourceFreeVars(funcCodes[name], funcSet) {
+			if dep != name {
+				deps[name] = append(deps[name], dep)
+			}
+		}
+	}
+
+	emitted := make(map[string]struct{}, len(funcs))
+	for len(emitted) < len(funcs) {
+		progress := false
+		for _, name := range funcs {
+			if _, ok := emitted[name]; ok {
+				continue
+			}
+			ready := true
+			for _, dep := range deps[name] {
+				if _, ok := emitted[dep]; !ok {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+			ordered = append(ordered, name)
+			emitted[name] = struct{}{}
+			progress = true
+		}
+		// 存在循环引用时按原有顺序输出剩余的函数
+		if !progress {
+			for _, name := range funcs {
+				if _, ok := emitted[name]; !ok {
+					ordered = append(ordered, name)
+					emitted[name] = struct{}{}
+				}
+			}
+		}
+	}
+	return ordered
+}
+
+// 解析函数源码并获取自由变量
+func funcSourceFreeVars(source string, candidates map[string]struct{}) []string {
+	expr, err := parser.ParseExpr(source)
+	if err != nil {
+		return nil
+	}
+	lit, ok := expr.(*ast.FuncLit)
+	if !ok {
+		return nil
+	}
+	return funcLitFreeVars(lit, candidates)
+}
+
+// 获取函数字面量中引用的外部变量
+// 功能需求:
+// - 只返回 candidates 中的变量名（main 函数中的会话变量），按首次出现顺序排列
+// - 按照代码块的作用域判断局部变量，参数、返回值以及 :=、var、range 声明的变量只在所在的代码块中遮蔽外部变量
+// - 选择器的字段名（比如 u.Name 中的 Name）不算变量
+func funcLitFreeVars(lit *ast.FuncLit, candidates map[string]struct{}) []string {
+	if lit == nil || len(candidates) == 0 {
+		return nil
+	}
+	w := &freeVarWalker{candidates: candidates, seen: make(map[string]struct{})}
+	w.walk(lit)
+	return w.names
+}
+
+// 按作用域遍历函数字面量，记录引用的外部变量
+type freeVarWalker struct {
+	candidates map[string]struct{}
+	scopes     []map[string]struct{} // 从外到内的代码块作用域中声明的变量
+	seen       map[string]struct{}
+	names      []string
+}
+
+func (w *freeVarWalker) walk(node ast.Node) {
+	if node == nil {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.Ident:
+			w.use(node.Name)
+		case *ast.SelectorExpr:
+			w.walk(node.X)
+			return false
+		case *ast.FuncLit:
+			w.push()
+			w.declareFields(node.Type.Params)
+			w.declareFields(node.Type.Results)
+			w.walkStmts(node.Body.List)
+			w.pop()
+			return false
+		case *ast.BlockStmt:
+			w.push()
+			w.walkStmts(node.List)
+			w.pop()
+			return false
+		case *ast.AssignStmt:
+			if node.Tok != token.DEFINE {
+				return true
+			}
+			for _, rhs := range node.Rhs {
+				w.walk(rhs)
+			}
+			for _, lhs := range node.Lhs {
+				w.declareExpr(lhs)
+			}
+			return false
+		case *ast.ValueSpec:
+			for _, value := range node.Values {
+				w.walk(value)
+			}
+			for _, name := range node.Names {
+				w.declare(name.Name)
+			}
+			return false
+		case *ast.TypeSpec:
+			w.declare(node.Name.Name)
+			return false
+		case *ast.RangeStmt:
+			w.walk(node.X)
+			w.push()
+			if node.Tok == token.DEFINE {
+				w.declareExpr(node.Key)
+				w.declareExpr(node.Value)
+			} else {
+				w.walk(node.Key)
+				w.walk(node.Value)
+			}
+			w.walkStmts(node.Body.List)
+			w.pop()
+			return false
+		case *ast.IfStmt:
+			w.push()
+			w.walk(node.Init)
+			w.walk(node.Cond)
+			w.walk(node.Body)
+			w.walk(node.Else)
+			w.pop()
+			return false
+		case *ast.ForStmt:
+			w.push()
+			w.walk(node.Init)
+			w.walk(node.Cond)
+			w.walk(node.Post)
+			w.walk(node.Body)
+			w.pop()
+			return false
+		case *ast.SwitchStmt:
+			w.push()
+			w.walk(node.Init)
+			w.walk(node.Tag)
+			w.walk(node.Body)
+			w.pop()
+			return false
+		case *ast.TypeSwitchStmt:
+			w.push()
+			w.walk(node.Init)
+			w.walk(node.Assign)
+			w.walk(node.Body)
+			w.pop()
+			return false
+		case *ast.CaseClause:
+			for _, expr := range node.List {
+				w.walk(expr)
+			}
+			w.push()
+			w.walkStmts(node.Body)
+			w.pop()
+			return false
+		case *ast.CommClause:
+			w.push()
+			w.walk(node.Comm)
+			w.walkStmts(node.Body)
+			w.pop()
+			return false
+		case *ast.LabeledStmt:
+			w.walk(node.Stmt)
+			return false
+		case *ast.BranchStmt:
+			return false
+		}
+		return true
+	})
+}
+
+func (w *freeVarWalker) walkStmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		w.walk(stmt)
+	}
+}
+
+func (w *freeVarWalker) push() {
+	w.scopes = append(w.scopes, make(map[string]struct{}))
+}
+
+func (w *freeVarWalker) pop() {
+	w.scopes = w.scopes[:len(w.scopes)-1]
+}
+
+func (w *freeVarWalker) declare(name string) {
+	w.scopes[len(w.scopes)-1][name] = struct{}{}
+}
+
+func (w *freeVarWalker) declareExpr(expr ast.Expr) {
+	if ident, ok := expr.(*ast.Ident); ok {
+		w.declare(ident.Name)
+	}
+}
+
+func (w *freeVarWalker) declareFields(fields *ast.FieldList) {
+	if fields == nil {
+		return
+	}
+	for _, field := range fields.List {
+		for _, name := range field.Names {
+			w.declare(name.Name)
+		}
+	}
+}
+
+// 引用的变量不在任何一层作用域中声明，并且是会话变量时记录为外部变量
+func (w *freeVarWalker) use(name string) {
+	if _, ok := w.candidates[name]; !ok {
+		return
+	}
+	for i := len(w.scopes) - 1; i >= 0; i-- {
+		if _, ok := w.scopes[i][name]; ok {
+			return
+		}
+	}
+	if _, ok := w.seen[name]; ok {
+		return
+	}
+	w.seen[name] = struct{}{}
+	w.names = append(w.names, name)
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wxnacy/go-tools"
+)
+
+// 准备运行代码需要的目录和内置文件
+func prepareTestWorkspace(t *testing.T) {
+	t.Helper()
+	for _, dir := range []string{GetMainDir(), GetTempDir()} {
+		tools.DirExistsOrCreate(dir)
+		if err := WriteCode(BuiltinFuncCode, filepath.Join(dir, "builtin_func.go")); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteCode(GetRequest().ToCode(), filepath.Join(dir, "request.go")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := InitModFile(GetMainDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(GetMainDir())
+		os.RemoveAll(GetTempDir())
+	})
+}
+
+func TestFuncLitFreeVars(t *testing.T) {
+	code := `func(n int) int {
+	total := base + n
+	for i := range items {
+		total += i
+	}
+	u.Name = "x"
+	return total + other.count + helper(n)
+}`
+	candidates := map[string]struct{}{
+		"base": {}, "items": {}, "n": {}, "total": {}, "i": {}, "Name": {}, "other": {}, "count": {}, "helper": {},
+	}
+	got := funcSourceFreeVars(code, candidates)
+	expect := []string{"base", "items", "other", "helper"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("自由变量期望 %v, 实际 %v", expect, got)
+	}
+}
+
+// 内部代码块中声明的同名变量只在该代码块中遮蔽外部变量
+func TestFuncLitFreeVarsBlockScope(t *testing.T) {
+	candidates := map[string]struct{}{"x": {}, "y": {}, "z": {}, "v": {}}
+	cases := map[string][]string{
+		"func() int { if ok { x := 1; _ = x }; return x }":                 {"x"},
+		"func() int { { var x = 1; _ = x }; return x }":                    {"x"},
+		"func() { for _, x := range y { _ = x }; _ = x }":                  {"y", "x"},
+		"func() int { x := x + 1; return x }":                              {"x"},
+		"func() { switch v := z.(type) { case int: _ = v }; _ = v }":       {"z", "v"},
+		"func(x int) int { return x }":                                     nil,
+		"func() int { x := 1; if ok { return x }; return x }":              nil,
+		"func() { for i := 0; i < 3; i++ { y := i; _ = y } }":              nil,
+		"func() func() int { return func() int { x := 1; return x + y } }": {"y"},
+		"func() { f := func(y int) int { return y }; _ = f; _ = y }":       {"y"},
+		"func() { if x := 1; x > 0 { _ = x } else { _ = x }; _ = z }":      {"z"},
+		"func() { select { case v := <-ch: _ = v }; _ = v }":               {"v"},
+	}
+	for code, expect := range cases {
+		if got := funcSourceFreeVars(code, candidates); !reflect.DeepEqual(got, expect) {
+			t.Fatalf("%s\n自由变量期望 %v, 实际 %v", code, expect, got)
+		}
+	}
+}
+
+// 函数字面量使用 _SerializeFunc 序列化，并记录源码
+func TestSerializeCodeVarsUsesSerializeFunc(t *testing.T) {
+	c := &Coder{}
+	code := `package main
+
+func main() {
+	count := 1
+	inc := func() int { count++; return count }
+}
+`
+	got := c.SerializeCodeVars(code)
+	if !strings.Contains(got, `_Serialize("var-count", count)`) {
+		t.Fatalf("普通变量应使用 _Serialize: %s", got)
+	}
+	expect := `_SerializeFunc("var-inc", inc, "func() int { count++; return count }")`
+	if !strings.Contains(got, expect) {
+		t.Fatalf("函数变量应使用 _SerializeFunc, 期望包含 %s, 实际: %s", expect, got)
+	}
+	if names := serializeCallNamesFromCode(t, got); !reflect.DeepEqual(names, []string{"count", "inc"}) {
+		t.Fatalf("序列化变量顺序异常: %v", names)
+	}
+}
+
+// 函数变量放在普通变量之后，依赖的函数先定义
+func TestOrderReplayVars(t *testing.T) {
+	names := []string{"quad", "a", "double", "b"}
+	funcCodes := map[string]string{
+		"quad":   "func(n int) int { return double(double(n)) }",
+		"double": "func(n int) int { return n * a }",
+	}
+	got := orderReplayVars(names, funcCodes)
+	expect := []string{"a", "b", "double", "quad"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("重建顺序期望 %v, 实际 %v", expect, got)
+	}
+}
+
+// FuncCodeMap 中没有记录时，从 _SerializeFunc 保存的记录中恢复函数源码，闭包引用的变量使用反序列化后的值
+func TestInputAndRunRestoresClosureFromRecord(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+
+	for _, input := range []string{"base := 10", "add := func(n int) int { return base + n }"} {
+		if _, err := c.InputAndRun(input); err != nil {
+			t.Fatalf("运行 %q 返回错误: %v", input, err)
+		}
+	}
+	if out, err := c.InputAndRun("add(1)"); err != nil || out != "11" {
+		t.Fatalf("第一次调用结果不符合预期: %q %v", out, err)
+	}
+	if _, err := c.InputAndRun("base = 20"); err != nil {
+		t.Fatalf("运行返回错误: %v", err)
+	}
+
+	// 模拟新的进程，只保留变量名
+	c.FuncCodeMap = nil
+	out, err := c.InputAndRun("add(2)")
+	if err != nil || out != "22" {
+		t.Fatalf("从记录重建的闭包结果不符合预期: %q %v", out, err)
+	}
+	if c.FuncCodeMap["add"] == "" {
+		t.Fatalf("重建后应回填 FuncCodeMap: %#v", c.FuncCodeMap)
+	}
+}
+
+// 递归函数先声明变量再赋值
+func TestInputAndRunRestoresRecursiveFunc(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+
+	input := "var fib func(int) int; fib = func(n int) int { if n < 2 { return n } else { return fib(n-1) + fib(n-2) } }"
+	if _, err := c.InputAndRun(input); err != nil {
+		t.Fatalf("运行返回错误: %v", err)
+	}
+	out, err := c.InputAndRun("fib(10)")
+	if err != nil || out != "55" {
+		t.Fatalf("递归函数结果不符合预期: %q %v", out, err)
+	}
+}
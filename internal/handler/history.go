@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const (
+	OUT_PREFIX     = "out-"      // 输出结果序列化文件的前缀
+	PRINT_OUT_FUNC = "_PrintOut" // 自动打印并保存输出结果的内置函数
+)
+
+var outNamePattern = regexp.MustCompile(`^_(\d+)$`)
+
+// 一次输入，类似 IPython 的 In[n]/Out[n]
+type Cell struct {
+	Num    int    // 输入编号，从 1 开始
+	Input  string // 输入内容
+	HasOut bool   // 是否保存了输出结果，可以通过 _n、Out[n] 引用
+	Output string // 运行的输出，不含颜色
+	Error  string // 运行失败时的错误，不含颜色，成功时为空
+}
+
+// 开始一次新的输入，返回输入编号
+func (c *Coder) startCell(input string) int {
+	num := len(c.Cells) + 1
+	c.Cells = append(c.Cells, Cell{Num: num, Input: input})
+	return num
+}
+
+// 下一次输入的编号，会话模式下按执行次数计数
+func (c *Coder) NextCellNum() int {
+	if c.session != nil {
+		return c.sessionRuns + 1
+	}
+	return len(c.Cells) + 1
+}
+
+// 运行成功后检查是否保存了输出结果
+func (c *Coder) finishCell(num int) {
+	if _, err := ReadOutType(num); err == nil {
+		c.Cells[num-1].HasOut = true
+	}
+}
+
+// 保存输入的运行结果，去掉输出和错误中的颜色
+func (c *Coder) recordCell(num int, out string, err error) {
+	cell := &c.Cells[num-1]
+	cell.Output = stripColor(out)
+	cell.Error = ""
+	if err != nil {
+		cell.Error = stripColor(err.Error())
+	}
+}
+
+// 获取最近一次输入
+func (c *Coder) LastCell() (Cell, bool) {
+	if len(c.Cells) == 0 {
+		return Cell{}, false
+	}
+	return c.Cells[len(c.Cells)-1], true
+}
+
+// 保存了输出结果的输入编号，按照从小到大排列
+func (c *Coder) OutNums() []int {
+	nums := make([]int, 0)
+	for _, cell := range c.Cells {
+		if cell.HasOut {
+			nums = append(nums, cell.Num)
+		}
+	}
+	return nums
+}
+
+func (c *Coder) hasOut(num int) bool {
+	return num >= 1 && num <= len(c.Cells) && c.Cells[num-1].HasOut
+}
+
+// 读取输出结果序列化时保存的类型，并去掉会话内声明类型的 main. 前缀
+// 类型中包含其他包未导出的类型时无法在代码中使用，返回错误
+func ReadOutType(num int) (string, error) {
+	typeName, err := ReadCode(filepath.Join(GetTempDir(), fmt.Sprintf("%s%d.type", OUT_PREFIX, num)))
+	if err != nil {
+		return "", err
+	}
+	typeName = mainTypePrefixPattern.ReplaceAllString(typeName, "")
+	if !isReplayableType(typeName) {
+		return "", fmt.Errorf("类型 %s 无法在代码中使用", typeName)
+	}
+	return typeName, nil
+}
+
+// 判断类型是否可以在代码中书写，比如 *errors.errorString 就不可以
+func isReplayableType(typeName string) bool {
+	expr, err := parser.ParseExpr(typeName)
+	if err != nil {
+		return false
+	}
+	ok := true
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, isSel := n.(*ast.SelectorExpr); isSel && !sel.Sel.IsExported() {
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// 拼接自动打印的代码，num 大于 0 时同时保存为第 num 个输出结果
+func printCall(num int, expr string) string {
+	if num > 0 {
+		return fmt.Sprintf("%s(%d, %s)", PRINT_OUT_FUNC, num, expr)
+	}
+	return fmt.Sprintf("%s(%s)", PRINT_FUNC, expr)
+}
+
+// 改写输入中对输出结果的引用
+// 功能需求:
+// - 作为值使用的 _ 改写为最近一次输出 _n，赋值、range 等位置的空白标识符不处理
+// - 没有定义过的 __ 改写为倒数第二次输出
+// - 没有定义过的 Out[n] 改写为 _n
+// - 输入不是合法的语句时不处理
+func (c *Coder) rewriteOutRefs(input string) string {
+	outs := c.OutNums()
+	if len(outs) == 0 {
+		return input
+	}
+	const prefix = "package main\nfunc _() {\n"
+	src := prefix + input + "\n}"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return input
+	}
+
+	unresolved := make(map[*ast.Ident]struct{}, len(file.Unresolved))
+	for _, ident := range file.Unresolved {
+		unresolved[ident] = struct{}{}
+	}
+	// 作为赋值目标、参数名等出现的空白标识符
+	blanks := make(map[*ast.Ident]struct{})
+	addBlanks := func(exprs ...ast.Expr) {
+		for _, expr := range exprs {
+			if ident, ok := expr.(*ast.Ident); ok && ident.Name == "_" {
+				blanks[ident] = struct{}{}
+			}
+		}
+	}
+
+	type replacement struct {
+		start, end int
+		text       string
+	}
+	var replacements []replacement
+	outName := func(back int) (string, bool) {
+		if len(outs) < back {
+			return "", false
+		}
+		return "_" + strconv.Itoa(outs[len(outs)-back]), true
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset - len(prefix)
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.AssignStmt:
+			addBlanks(node.Lhs...)
+		case *ast.RangeStmt:
+			addBlanks(node.Key, node.Value)
+		case *ast.ValueSpec:
+			for _, name := range node.Names {
+				addBlanks(name)
+			}
+		case *ast.Field:
+			for _, name := range node.Names {
+				addBlanks(name)
+			}
+		case *ast.IndexExpr:
+			ident, ok := node.X.(*ast.Ident)
+			lit, isLit := node.Index.(*ast.BasicLit)
+			if !ok || ident.Name != "Out" || !isLit || lit.Kind != token.INT {
+				return true
+			}
+			if _, ok := unresolved[ident]; !ok {
+				return true
+			}
+			replacements = append(replacements, replacement{offset(node.Pos()), offset(node.End()), "_" + lit.Value})
+			return false
+		case *ast.Ident:
+			if node.Name == "__" {
+				if _, ok := unresolved[node]; ok {
+					if name, ok := outName(2); ok {
+						replacements = append(replacements, replacement{offset(node.Pos()), offset(node.End()), name})
+					}
+				}
+			}
+			if node.Name == "_" {
+				if _, ok := blanks[node]; !ok {
+					if name, ok := outName(1); ok {
+						replacements = append(replacements, replacement{offset(node.Pos()), offset(node.End()), name})
+					}
+				}
+			}
+		}
+		return true
+	})
+	if len(replacements) == 0 {
+		return input
+	}
+
+	sort.Slice(replacements, func(i, j int) bool {
+		return replacements[i].start > replacements[j].start
+	})
+	for _, r := range replacements {
+		if r.start < 0 || r.end > len(input) {
+			return input
+		}
+		input = input[:r.start] + r.text + input[r.end:]
+	}
+	return input
+}
+
+// 拼接输入中引用的输出结果的反序列化代码
+// 已经作为变量保存的同名变量不处理
+func (c *Coder) outReplayLines(input string) []string {
+	saved := make(map[string]struct{}, len(c.VarNames))
+	for _, v := range c.VarNames {
+		saved[v] = struct{}{}
+	}
+
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", fset.Base(), len(input)), []byte(input), nil, 0)
+	var lines []string
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.IDENT {
+			continue
+		}
+		matches := outNamePattern.FindStringSubmatch(lit)
+		if matches == nil {
+			continue
+		}
+		if _, ok := saved[lit]; ok {
+			continue
+		}
+		num, _ := strconv.Atoi(matches[1])
+		if !c.hasOut(num) {
+			continue
+		}
+		typeName, err := ReadOutType(num)
+		if err != nil {
+			continue
+		}
+		saved[lit] = struct{}{}
+		lines = append(lines, fmt.Sprintf("%s, _ := _Deserialize[%s](\"%s%d\")", lit, typeName, OUT_PREFIX, num))
+	}
+	return lines
+}
+
+// 是否是输出结果的变量名，比如 _1，不作为普通变量保存
+func isOutName(name string) bool {
+	return outNamePattern.MatchString(name)
+}
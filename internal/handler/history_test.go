@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRewriteOutRefs(t *testing.T) {
+	c := &Coder{Cells: []Cell{{Num: 1, HasOut: true}, {Num: 2}, {Num: 3, HasOut: true}}}
+	cases := map[string]string{
+		"_ + 1":                          "_3 + 1",
+		"__ * _":                         "_1 * _3",
+		"Out[1] + Out[3]":                "_1 + _3",
+		"_, b := f(_)":                   "_, b := f(_3)",
+		"for _, v := range xs { _ = v }": "for _, v := range xs { _ = v }",
+		"var _ = _":                      "var _ = _3",
+		`"_ + 1"`:                        `"_ + 1"`,
+		"Out := map[int]int{}; Out[1]":   "Out := map[int]int{}; Out[1]",
+		"if x {":                         "if x {",
+	}
+	for input, expect := range cases {
+		if got := c.rewriteOutRefs(input); got != expect {
+			t.Fatalf("%s 改写结果不符合预期: 期望 %q, 实际 %q", input, expect, got)
+		}
+	}
+	if got := (&Coder{}).rewriteOutRefs("_ + 1"); got != "_ + 1" {
+		t.Fatalf("没有输出结果时不应改写: %q", got)
+	}
+}
+
+func TestIsReplayableType(t *testing.T) {
+	cases := map[string]bool{
+		"int":                    true,
+		"map[string][]User":      true,
+		"time.Time":              true,
+		"*errors.errorString":    false,
+		"[]*fs.dirEntry":         false,
+		"struct { Name string }": true,
+	}
+	for typeName, expect := range cases {
+		if got := isReplayableType(typeName); got != expect {
+			t.Fatalf("%s 期望 %v, 实际 %v", typeName, expect, got)
+		}
+	}
+}
+
+// 通过 _、__、_n、Out[n] 引用之前的输出结果
+func TestInputAndRunOutHistory(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	steps := []struct {
+		input  string
+		expect string
+	}{
+		{"1 + 2", "3"},
+		{`name := "wgo"`, ""},
+		{"_ * 10", "30"},
+		{"Out[1] + __", "6"},
+		{`[]string{"a", "b"}`, `[]string{"a", "b"}`},
+		{"len(_) + _3", "32"},
+	}
+	for _, step := range steps {
+		if out, err := c.InputAndRun(step.input); err != nil || out != step.expect {
+			t.Fatalf("%s 结果不符合预期: %q %v", step.input, out, err)
+		}
+	}
+	if !reflect.DeepEqual(c.OutNums(), []int{1, 3, 4, 5, 6}) {
+		t.Fatalf("输出编号不符合预期: %v", c.OutNums())
+	}
+	if cell, ok := c.LastCell(); !ok || cell.Num != 6 || cell.Input != "len(_) + _3" || !cell.HasOut {
+		t.Fatalf("最近一次输入不符合预期: %+v", cell)
+	}
+	if num := c.NextCellNum(); num != 7 {
+		t.Fatalf("下一次输入的编号应为 7，实际: %d", num)
+	}
+	if !reflect.DeepEqual(c.VarNames, []string{"name"}) {
+		t.Fatalf("输出结果不应作为变量保存: %v", c.VarNames)
+	}
+}
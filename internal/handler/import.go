@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/wxnacy/go-tools"
+)
+
+var (
+	dotImportScopes   = map[string]*types.Scope{}
+	dotImportScopesMu sync.Mutex
+
+	packageNames   = map[string]string{}
+	packageNamesMu sync.Mutex
+)
+
+// 用户通过 import 语句显式导入的包
+type Import struct {
+	Name string // 包的别名，为空时使用包名，也可以是 . 或 _
+	Path string
+}
+
+func (i Import) String() string {
+	if i.Name == "" {
+		return strconv.Quote(i.Path)
+	}
+	return i.Name + " " + strconv.Quote(i.Path)
+}
+
+// 导入后在代码中使用的名称，. 和 _ 导入返回空字符串
+func (i Import) localName() string {
+	switch i.Name {
+	case ".", "_":
+		return ""
+	case "":
+		return packageName(i.Path)
+	}
+	return i.Name
+}
+
+// 获取导入路径对应的包名
+// 功能需求:
+// - 标准库的包名和路径最后一段相同
+// - 其他包在会话模块中使用 go list 读取真实的包名，不访问网络，结果缓存
+// - 无法读取时按路径推断包名，见 assumedPackageName
+func packageName(importPath string) string {
+	if isStdImportPath(importPath) {
+		return path.Base(importPath)
+	}
+	packageNamesMu.Lock()
+	defer packageNamesMu.Unlock()
+	if name, ok := packageNames[importPath]; ok {
+		return name
+	}
+	name := lookupPackageName(importPath)
+	if name == "" {
+		name = assumedPackageName(importPath)
+	}
+	packageNames[importPath] = name
+	return name
+}
+
+// 清空包名缓存，会话模块的依赖变化后调用
+func resetPackageNames() {
+	packageNamesMu.Lock()
+	defer packageNamesMu.Unlock()
+	packageNames = map[string]string{}
+}
+
+func isStdImportPath(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+func lookupPackageName(importPath string) string {
+	dir := GetMainDir()
+	if !tools.FileExists(filepath.Join(dir, "go.mod")) {
+		return ""
+	}
+	env := append(sessionGoEnv(dir), "GOPROXY=off")
+	out, err := CommandInDir(dir, env, "go", "list", "-e", "-f", "{{.Name}}", importPath)
+	if err != nil {
+		logger.Debugf("读取包 %s 的包名失败: %v", importPath, err)
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// 按导入路径推断包名，规则和 goimports 相同
+// - 去掉 /vN 版本后缀，比如 github.com/go-chi/chi/v5 为 chi
+// - 去掉 go- 前缀，比如 github.com/x/go-foo 为 foo
+// - 截断第一个不能用在标识符中的字符，比如 gopkg.in/yaml.v3 为 yaml
+func assumedPackageName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil {
+			if dir := path.Dir(importPath); dir != "." {
+				base = path.Base(dir)
+			}
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+func importFromSpec(spec *ast.ImportSpec) (Import, bool) {
+	p, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return Import{}, false
+	}
+	imp := Import{Path: p}
+	if spec.Name != nil {
+		imp.Name = spec.Name.Name
+	}
+	return imp, true
+}
+
+// 保存导入的包
+// 相同的导入或者代码中使用相同名称的导入会替换之前的版本，比如先导入 math/rand 再导入 crypto/rand
+func (c *Coder) putImports(imports []Import) {
+	for _, imp := range imports {
+		replaced := false
+		filtered := make([]Import, 0, len(c.Imports)+1)
+		for _, existing := range c.Imports {
+			conflict := existing == imp ||
+				(imp.localName() != "" && existing.localName() == imp.localName())
+			if !conflict {
+				filtered = append(filtered, existing)
+				continue
+			}
+			if !replaced {
+				filtered = append(filtered, imp)
+				replaced = true
+			}
+		}
+		if !replaced {
+			filtered = append(filtered, imp)
+		}
+		c.Imports = filtered
+	}
+}
+
+// 删除导入的包，nameOrPath 可以是包的路径或者代码中使用的名称
+func (c *Coder) RemoveImport(nameOrPath string) bool {
+	removed := false
+	filtered := make([]Import, 0, len(c.Imports))
+	for _, imp := range c.Imports {
+		if imp.Path == nameOrPath || (imp.localName() != "" && imp.localName() == nameOrPath) {
+			removed = true
+			continue
+		}
+		filtered = append(filtered, imp)
+	}
+	c.Imports = filtered
+	return removed
+}
+
+// 拼接导入代码
+// 功能需求:
+// - 按 imports 的顺序生成 import 块
+// - 未使用的普通导入由 ImportsInFile 删除，但 . 导入不会被删除，需要在这里判断
+//   - body 中有未解析的标识符属于该包时才导入，否则会报 imported and not used
+//
+// - verify 是本次输入中导入的包，额外使用 _ 导入，保证包不存在时运行报错，而不是被 ImportsInFile 删除
+func joinImportCode(imports []Import, verify []Import, body string) string {
+	if len(imports) == 0 && len(verify) == 0 {
+		return ""
+	}
+	var unresolved map[string]struct{}
+	lines := make([]string, 0, len(imports))
+	for _, imp := range imports {
+		if imp.Name == "." {
+			if unresolved == nil {
+				unresolved = unresolvedIdents(body)
+			}
+			if !dotImportUsed(imp.Path, unresolved) {
+				continue
+			}
+		}
+		lines = append(lines, "\t"+imp.String())
+	}
+	for _, imp := range verify {
+		lines = append(lines, "\t"+Import{Name: "_", Path: imp.Path}.String())
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nimport (\n%s\n)\n", strings.Join(lines, "\n"))
+}
+
+// 获取代码中没有在文件内定义的标识符
+func unresolvedIdents(code string) map[string]struct{} {
+	names := make(map[string]struct{})
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, 0)
+	if err != nil {
+		return names
+	}
+	for _, ident := range file.Unresolved {
+		names[ident.Name] = struct{}{}
+	}
+	return names
+}
+
+// 判断 . 导入的包是否被使用，无法加载包信息时保留导入，由编译器报告错误
+func dotImportUsed(importPath string, unresolved map[string]struct{}) bool {
+	scope, err := loadPackageScope(importPath)
+	if err != nil {
+		logger.Debugf("加载包 %s 失败: %v", importPath, err)
+		return true
+	}
+	for name := range unresolved {
+		if token.IsExported(name) && scope.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func loadPackageScope(importPath string) (*types.Scope, error) {
+	dotImportScopesMu.Lock()
+	defer dotImportScopesMu.Unlock()
+	if scope, ok := dotImportScopes[importPath]; ok {
+		return scope, nil
+	}
+	pkg, err := importer.ForCompiler(token.NewFileSet(), "source", nil).Import(importPath)
+	if err != nil {
+		return nil, err
+	}
+	dotImportScopes[importPath] = pkg.Scope()
+	return pkg.Scope(), nil
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDeclInputImports(t *testing.T) {
+	_, imports, ok := parseDeclInput(`import ( cr "crypto/rand"; . "strings"; _ "embed"; "fmt" )`)
+	if !ok {
+		t.Fatal("import 语句应被识别")
+	}
+	expect := []Import{{Name: "cr", Path: "crypto/rand"}, {Name: ".", Path: "strings"}, {Name: "_", Path: "embed"}, {Path: "fmt"}}
+	if !reflect.DeepEqual(imports, expect) {
+		t.Fatalf("导入不符合预期: %v", imports)
+	}
+}
+
+// 相同的导入或者相同名称的导入替换之前的版本
+func TestPutImportsReplaces(t *testing.T) {
+	c := &Coder{}
+	c.putImports([]Import{{Path: "math/rand"}, {Path: "fmt"}})
+	c.putImports([]Import{{Path: "crypto/rand"}, {Name: "f", Path: "fmt"}, {Path: "fmt"}})
+	expect := []Import{{Path: "crypto/rand"}, {Path: "fmt"}, {Name: "f", Path: "fmt"}}
+	if !reflect.DeepEqual(c.Imports, expect) {
+		t.Fatalf("导入不符合预期: %v", c.Imports)
+	}
+
+	if !c.RemoveImport("rand") || !c.RemoveImport("fmt") {
+		t.Fatal("应可以通过名称或路径删除导入")
+	}
+	if c.RemoveImport("rand") || len(c.Imports) != 0 {
+		t.Fatalf("导入应已全部删除: %v", c.Imports)
+	}
+}
+
+// 未使用的 . 导入不拼接到代码中
+func TestJoinImportCodeDotImport(t *testing.T) {
+	imports := []Import{{Name: ".", Path: "strings"}, {Name: "str", Path: "strings"}}
+	code := joinImportCode(imports, nil, "package main\n\nfunc main() {\n\tstr.ToUpper(\"a\")\n}")
+	if strings.Contains(code, `. "strings"`) || !strings.Contains(code, `str "strings"`) {
+		t.Fatalf("未使用的 . 导入不应拼接: %s", code)
+	}
+	code = joinImportCode(imports, nil, "package main\n\nfunc main() {\n\tToUpper(\"a\")\n}")
+	if !strings.Contains(code, `. "strings"`) {
+		t.Fatalf("使用的 . 导入应拼接: %s", code)
+	}
+}
+
+// 显式导入的包在之后的输入中保持生效
+func TestInputAndRunExplicitImports(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+
+	for _, input := range []string{`import "crypto/rand"`, `import . "strings"`, `import str "strings"`} {
+		if _, err := c.InputAndRun(input); err != nil {
+			t.Fatalf("运行 %q 返回错误: %v", input, err)
+		}
+	}
+	if out, err := c.InputAndRun("fmt.Println(rand.Reader != nil)"); err != nil || out != "true" {
+		t.Fatalf("应使用 crypto/rand: %q %v", out, err)
+	}
+	if out, err := c.InputAndRun(`fmt.Println(ToUpper("wgo"), str.Repeat("a", 2))`); err != nil || out != "WGO aa" {
+		t.Fatalf("别名和 . 导入结果不符合预期: %q %v", out, err)
+	}
+	if out, err := c.InputAndRun("1 + 1"); err != nil || out != "2" {
+		t.Fatalf("未使用的导入不应报错: %q %v", out, err)
+	}
+
+	if _, err := c.InputAndRun(`import "not/exist/pkg"`); err == nil {
+		t.Fatal("导入不存在的包应返回错误")
+	}
+	if len(c.Imports) != 3 {
+		t.Fatalf("运行失败的导入不应保存: %v", c.Imports)
+	}
+}
+
+// 包名和路径最后一段不同的导入按真实包名处理
+func TestAssumedPackageName(t *testing.T) {
+	for importPath, expect := range map[string]string{
+		"gopkg.in/yaml.v3":         "yaml",
+		"github.com/go-chi/chi/v5": "chi",
+		"github.com/x/go-foo":      "foo",
+		"github.com/x/foo-go":      "foo",
+		"math/rand/v2":             "rand",
+		"github.com/x/bar":         "bar",
+	} {
+		if name := assumedPackageName(importPath); name != expect {
+			t.Errorf("%s 的包名应为 %s，实际: %s", importPath, expect, name)
+		}
+	}
+}
+
+// 不同路径的同名包相互替换，可以通过包名删除
+func TestPutImportsVersionedPaths(t *testing.T) {
+	c := &Coder{}
+	c.putImports([]Import{{Path: "gopkg.in/yaml.v2"}, {Path: "github.com/go-chi/chi"}, {Path: "github.com/x/go-foo"}})
+	c.putImports([]Import{{Path: "gopkg.in/yaml.v3"}, {Path: "github.com/go-chi/chi/v5"}})
+	expect := []Import{{Path: "gopkg.in/yaml.v3"}, {Path: "github.com/go-chi/chi/v5"}, {Path: "github.com/x/go-foo"}}
+	if !reflect.DeepEqual(c.Imports, expect) {
+		t.Fatalf("导入不符合预期: %v", c.Imports)
+	}
+	for _, name := range []string{"yaml", "chi", "foo"} {
+		if !c.RemoveImport(name) {
+			t.Fatalf("应可以通过包名 %s 删除导入", name)
+		}
+	}
+}
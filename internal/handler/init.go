@@ -20,6 +20,9 @@ func Init() {
 		WriteCode(BuiltinFuncCode, filepath.Join(dir, "builtin_func.go"))
 		WriteCode(GetRequest().ToCode(), filepath.Join(dir, "request.go"))
 	}
+	if err := InitModFile(GetMainDir()); err != nil {
+		logger.Errorf("初始化 go.mod 失败: %v", err)
+	}
 	logger.Infof("MainFile %s", GetMainFile())
 	logger.Infof("TempDir %s", GetTempDir())
 	logger.Infoln("Init End")
@@ -27,6 +30,9 @@ func Init() {
 
 func Destory() {
 	logger.Infoln("Destory Begin")
+	for kind, s := range GetCompileCache().Stats() {
+		logger.Infof("编译缓存 %s 命中 %d 次，未命中 %d 次", kind, s.Hits, s.Misses)
+	}
 	os.RemoveAll(GetMainDir())
 	os.RemoveAll(GetTempDir())
 	logger.Infoln("Destory End")
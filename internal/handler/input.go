@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// 行尾是这些符号时，输入还没有结束，比如 a := 1 +
+var continuationTokens = map[token.Token]struct{}{
+	token.COMMA: {}, token.PERIOD: {}, token.ASSIGN: {}, token.DEFINE: {},
+	token.ADD: {}, token.SUB: {}, token.MUL: {}, token.QUO: {}, token.REM: {},
+	token.AND: {}, token.OR: {}, token.XOR: {}, token.SHL: {}, token.SHR: {}, token.AND_NOT: {},
+	token.LAND: {}, token.LOR: {}, token.ARROW: {},
+	token.EQL: {}, token.NEQ: {}, token.LSS: {}, token.LEQ: {}, token.GTR: {}, token.GEQ: {},
+	token.ADD_ASSIGN: {}, token.SUB_ASSIGN: {}, token.MUL_ASSIGN: {}, token.QUO_ASSIGN: {}, token.REM_ASSIGN: {},
+	token.AND_ASSIGN: {}, token.OR_ASSIGN: {}, token.XOR_ASSIGN: {}, token.SHL_ASSIGN: {}, token.SHR_ASSIGN: {},
+	token.AND_NOT_ASSIGN: {},
+}
+
+// 判断输入是否完整，不完整时需要继续输入下一行
+// 功能需求:
+// - 使用 go/scanner 扫描，括号 ()、[]、{} 没有闭合时不完整
+// - 反引号字符串、块注释没有结束时不完整
+// - 最后一个符号是逗号、点、赋值或二元运算符时不完整
+// - 右括号多于左括号等无法继续的错误视为完整，交给编译报错
+func IsCompleteInput(input string) bool {
+	if strings.TrimSpace(input) == "" {
+		return true
+	}
+	incomplete := false
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(input))
+	s.Init(file, []byte(input), func(pos token.Position, msg string) {
+		if strings.Contains(msg, "raw string literal not terminated") ||
+			strings.Contains(msg, "comment not terminated") {
+			incomplete = true
+		}
+	}, scanner.ScanComments)
+
+	depth := 0
+	last := token.ILLEGAL
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.COMMENT:
+			continue
+		case token.SEMICOLON:
+			// 换行自动插入的分号不影响最后一个符号
+			if lit == "\n" {
+				continue
+			}
+		}
+		last = tok
+	}
+	if incomplete || depth > 0 {
+		return false
+	}
+	if depth < 0 {
+		return true
+	}
+	_, ok := continuationTokens[last]
+	return !ok
+}
+
+// 将脚本按行拆分为多次输入，和交互模式中逐行输入相同
+// 功能需求:
+// - 通过 IsCompleteInput 判断，不完整时和下一行合并为一次输入
+// - 跳过输入之间的空行和单独的行注释
+// - 最后不完整的输入也会返回，运行时报错
+func SplitInputs(text string) []string {
+	inputs := make([]string, 0)
+	var buf []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(buf) == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "//")) {
+			continue
+		}
+		buf = append(buf, line)
+		if input := strings.Join(buf, "\n"); IsCompleteInput(input) {
+			inputs = append(inputs, input)
+			buf = buf[:0]
+		}
+	}
+	if len(buf) > 0 {
+		inputs = append(inputs, strings.Join(buf, "\n"))
+	}
+	return inputs
+}
+
+// 将多行输入中跨行的最后一个表达式合并为一行
+// 自动打印只处理输入的最后一行，比如多行的结构体字面量需要合并后才能被打印
+// 输入不是合法的语句，最后一个语句不是表达式，或者表达式中包含多条语句时不处理
+func collapseLastExpr(input string) string {
+	if !strings.Contains(strings.TrimSpace(input), "\n") {
+		return input
+	}
+	const prefix = "package main\nfunc _() {\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", prefix+input+"\n}", 0)
+	if err != nil {
+		return input
+	}
+	body := file.Decls[0].(*ast.FuncDecl).Body
+	if len(body.List) == 0 {
+		return input
+	}
+	stmt, ok := body.List[len(body.List)-1].(*ast.ExprStmt)
+	if !ok || fset.Position(stmt.Pos()).Line == fset.Position(stmt.End()).Line {
+		return input
+	}
+	start := fset.Position(stmt.Pos()).Offset - len(prefix)
+	end := fset.Position(stmt.End()).Offset - len(prefix)
+
+	// 按照符号重新拼接，去掉换行和注释
+	expr := input[start:end]
+	var s scanner.Scanner
+	exprSet := token.NewFileSet()
+	s.Init(exprSet.AddFile("", exprSet.Base(), len(expr)), []byte(expr), nil, 0)
+	var b strings.Builder
+	prev := token.ILLEGAL
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if prev == token.SEMICOLON {
+			// 函数字面量中有多条语句，JoinPrintCode 按照分号拆分，无法合并为一行
+			return input
+		}
+		if tok == token.SEMICOLON {
+			// 结尾自动插入的分号
+			prev = tok
+			continue
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		if tok == token.STRING && strings.Contains(lit, "\n") {
+			// 多行的反引号字符串无法合并为一行
+			return input
+		}
+		if b.Len() > 0 && needSpace(prev, tok) {
+			b.WriteString(" ")
+		}
+		b.WriteString(lit)
+		prev = tok
+	}
+	return input[:start] + b.String() + input[end:]
+}
+
+// 合并符号时是否需要空格，只在括号、逗号、点附近以及类型中省略
+func needSpace(prev, tok token.Token) bool {
+	switch prev {
+	case token.LPAREN, token.LBRACK, token.LBRACE, token.PERIOD, token.MUL, token.AND, token.ARROW:
+		return false
+	}
+	switch tok {
+	case token.RPAREN, token.RBRACK, token.RBRACE, token.COMMA, token.PERIOD, token.COLON, token.LBRACE:
+		return false
+	case token.LPAREN, token.LBRACK:
+		// 调用、索引以及 map[K]V、func()
+		switch prev {
+		case token.IDENT, token.RPAREN, token.RBRACK, token.MAP, token.FUNC:
+			return false
+		}
+	case token.IDENT, token.MUL:
+		// 类型中的 []T、[]*T
+		return prev != token.RBRACK
+	}
+	return true
+}
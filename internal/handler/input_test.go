@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsCompleteInput(t *testing.T) {
+	cases := map[string]bool{
+		"":                         true,
+		"a := 1":                   true,
+		"for i := 0; i < 3; i++ {": false,
+		"for i := 0; i < 3; i++ {\n\tfmt.Println(i)\n}": true,
+		"u := User{\n\tName: \"wgo\",":                  false,
+		"fmt.Println(1,":                                false,
+		"s := `line1":                                   false,
+		"s := `line1\nline2`":                           true,
+		"/* comment":                                    false,
+		"a := 1 +":                                      false,
+		"a := 1 + // 注释":                                false,
+		"x.":                                            false,
+		"a++":                                           true,
+		"}":                                             true,
+		`s := "{"`:                                      true,
+		"// {":                                          true,
+	}
+	for input, expect := range cases {
+		if got := IsCompleteInput(input); got != expect {
+			t.Fatalf("%q 期望 %v, 实际 %v", input, expect, got)
+		}
+	}
+}
+
+func TestSplitInputs(t *testing.T) {
+	text := "// 准备数据\na := 1\n\nfor i := 0; i < 3; i++ {\n\ta += i\n}\r\nb := a +\n\t1\n:vars\nfmt.Println(a,"
+	expect := []string{
+		"a := 1",
+		"for i := 0; i < 3; i++ {\n\ta += i\n}",
+		"b := a +\n\t1",
+		":vars",
+		"fmt.Println(a,",
+	}
+	if got := SplitInputs(text); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("拆分结果不符合预期:\n期望 %q\n实际 %q", expect, got)
+	}
+	if got := SplitInputs("\n// 注释\n"); len(got) != 0 {
+		t.Fatalf("没有输入时应返回空: %q", got)
+	}
+}
+
+func TestCollapseLastExpr(t *testing.T) {
+	cases := map[string]string{
+		"a := 1": "a := 1",
+		"User{\n\tName: \"wgo\", // 名称\n\tTags: []string{\"go\"},\n}": `User{Name: "wgo", Tags: []string{"go"},}`,
+		"a := 1\nmap[string]*User{\n\t\"a\": nil,\n}":                 "a := 1\nmap[string]*User{\"a\": nil,}",
+		"for i := 0; i < 3; i++ {\n\tfmt.Println(i)\n}":               "for i := 0; i < 3; i++ {\n\tfmt.Println(i)\n}",
+		"func() int {\n\ta := 1\n\treturn a\n}()":                     "func() int {\n\ta := 1\n\treturn a\n}()",
+		"fmt.Sprint(`a\nb`)":                                          "fmt.Sprint(`a\nb`)",
+	}
+	for input, expect := range cases {
+		if got := collapseLastExpr(input); got != expect {
+			t.Fatalf("%q 合并结果不符合预期:\n期望 %q\n实际 %q", input, expect, got)
+		}
+	}
+}
+
+// 多行输入可以直接运行，最后的多行表达式会被自动打印
+func TestInputAndRunMultiline(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	steps := []struct {
+		input  string
+		expect string
+	}{
+		{"total := 0\nfor i := 1; i <= 3; i++ {\n\ttotal += i\n}", ""},
+		{"total", "6"},
+		{"if total > 5 {\n\tfmt.Println(\"big\")\n} else {\n\tfmt.Println(\"small\")\n}", "big"},
+		{"[]int{\n\ttotal,\n\t1,\n}", "[]int{6, 1}"},
+	}
+	for _, step := range steps {
+		if out, err := c.InputAndRun(step.input); err != nil || out != step.expect {
+			t.Fatalf("%q 结果不符合预期: %q %v", step.input, out, err)
+		}
+	}
+}
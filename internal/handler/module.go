@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/wxnacy/go-tools"
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	// 会话目录中 go.mod 的模块名
+	SESSION_MODULE = "wgosession"
+	// 本地路径替换时使用的占位版本
+	LOCAL_MODULE_VERSION = "v0.0.0-00010101000000-000000000000"
+)
+
+var errModuleNotCached = errors.New("模块不在本地缓存中")
+
+// 初始化会话目录中的 go.mod
+// 会话代码在自己的模块中编译运行，不依赖当前目录所在的模块，已存在时不做处理
+func InitModFile(dir string) error {
+	modPath := filepath.Join(dir, "go.mod")
+	if tools.FileExists(modPath) {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	code := fmt.Sprintf("module %s\n\ngo %s\n", SESSION_MODULE, goVersion())
+	return WriteCode(code, modPath)
+}
+
+var (
+	localGoVersion     string
+	onceLocalGoVersion sync.Once
+)
+
+// 获取本地 go 命令的版本，比如 1.25.1
+// 只在第一次调用时运行 go env
+func goVersion() string {
+	onceLocalGoVersion.Do(func() {
+		localGoVersion = readGoVersion()
+	})
+	return localGoVersion
+}
+
+func readGoVersion() string {
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	version := strings.TrimSpace(string(out))
+	if err != nil || !strings.HasPrefix(version, "go") {
+		version = runtime.Version()
+	}
+	version = strings.TrimPrefix(version, "go")
+	// 开发版本等带有其他后缀的版本只保留版本号
+	if idx := strings.IndexAny(version, " -"); idx != -1 {
+		version = version[:idx]
+	}
+	return version
+}
+
+// 运行 go 命令
+// dir 在 MainDir 中时在 dir 中运行，使用会话模块：关闭 go.work，允许自动更新 go.sum
+// 其他目录（比如 wgo run 运行的文件）保持在当前目录中运行
+func GoCommand(dir string, args ...string) (string, error) {
+	return GoCommandContext(context.Background(), dir, args...)
+}
+
+// 和 GoCommand 相同，ctx 取消或超时时结束命令
+func GoCommandContext(ctx context.Context, dir string, args ...string) (string, error) {
+	dir, env := goCommandDir(dir)
+	return CommandContext(ctx, dir, env, "go", args...)
+}
+
+// 运行 go 命令时使用的目录和追加的环境变量
+func goCommandDir(dir string) (string, []string) {
+	env := sessionGoEnv(dir)
+	if env == nil {
+		return "", nil
+	}
+	return dir, env
+}
+
+func sessionGoEnv(dir string) []string {
+	mainDir := GetMainDir()
+	if dir != mainDir && !strings.HasPrefix(dir, mainDir+string(filepath.Separator)) {
+		return nil
+	}
+	return []string{"GOWORK=off", "GOFLAGS=-mod=mod"}
+}
+
+// 添加会话模块的依赖
+// 功能需求:
+// - spec 支持以下格式
+//   - 模块路径@版本，比如 github.com/foo/bar@v1.2.0，版本可以是 latest
+//   - 本地模块目录，比如 ../bar，读取目录中 go.mod 的模块名，添加依赖并 replace 到该目录
+//   - 模块路径=本地目录，比如 github.com/foo/bar=../bar
+//
+// - 只从本地模块缓存中获取，不访问网络，模块不在缓存中时返回 errModuleNotCached
+func GetModule(spec string) (string, error) {
+	dir := GetMainDir()
+	if err := InitModFile(dir); err != nil {
+		return "", err
+	}
+
+	// 依赖变化后之前读取失败的包名可能已经可以读取
+	defer resetPackageNames()
+
+	modPath, localDir, isLocal := parseLocalModuleSpec(spec)
+	if !isLocal {
+		return offlineGoGet(dir, spec)
+	}
+
+	if modPath == "" {
+		name, err := readModulePath(localDir)
+		if err != nil {
+			return "", err
+		}
+		modPath = name
+	}
+	if _, err := CommandInDir(dir, sessionGoEnv(dir), "go", "mod", "edit",
+		"-require="+modPath+"@"+LOCAL_MODULE_VERSION,
+		"-replace="+modPath+"="+localDir,
+	); err != nil {
+		return "", fmt.Errorf("添加依赖 %s 失败: %w", modPath, err)
+	}
+	return fmt.Sprintf("%s => %s", modPath, localDir), nil
+}
+
+// 解析本地模块
+// 返回模块路径（只指定目录时为空）和本地目录的绝对路径
+func parseLocalModuleSpec(spec string) (modPath, localDir string, ok bool) {
+	if idx := strings.Index(spec, "="); idx != -1 {
+		modPath, localDir = spec[:idx], spec[idx+1:]
+	} else {
+		localDir = spec
+	}
+	if strings.Contains(localDir, "@") {
+		return "", "", false
+	}
+	if !strings.HasPrefix(localDir, ".") && !filepath.IsAbs(localDir) && modPath == "" {
+		return "", "", false
+	}
+	if !filepath.IsAbs(localDir) {
+		localDir = filepath.Join(GetWorkspace(), localDir)
+	}
+	return modPath, filepath.Clean(localDir), true
+}
+
+// 读取本地目录中 go.mod 的模块名
+func readModulePath(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return "", fmt.Errorf("读取 %s 中的 go.mod 失败: %w", dir, err)
+	}
+	modPath := modfile.ModulePath(data)
+	if modPath == "" {
+		return "", fmt.Errorf("%s 中的 go.mod 没有模块名", dir)
+	}
+	return modPath, nil
+}
+
+// 使用本地模块缓存作为 GOPROXY 执行 go get
+func offlineGoGet(dir, spec string) (string, error) {
+	if !strings.Contains(spec, "@") {
+		spec += "@latest"
+	}
+	modCache, err := exec.Command("go", "env", "GOMODCACHE").Output()
+	if err != nil {
+		return "", fmt.Errorf("获取 GOMODCACHE 失败: %w", err)
+	}
+	proxy := "file://" + filepath.ToSlash(filepath.Join(strings.TrimSpace(string(modCache)), "cache", "download"))
+
+	cmd := exec.Command("go", "get", spec)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), sessionGoEnv(dir)...)
+	cmd.Env = append(cmd.Env, "GOPROXY="+proxy, "GOSUMDB=off")
+	out, err := cmd.CombinedOutput()
+	text := strings.TrimSpace(string(out))
+	if err != nil {
+		if isModuleNotCached(text) {
+			return "", fmt.Errorf("%w: %s，请先在联网环境中执行 go mod download %s\n%s", errModuleNotCached, spec, spec, text)
+		}
+		return "", fmt.Errorf("go get %s 失败: %s", spec, text)
+	}
+	return text, nil
+}
+
+func isModuleNotCached(text string) bool {
+	for _, s := range []string{"not found", "no such file or directory", "no matching versions", "module lookup disabled", "unknown revision", "invalid version"} {
+		if strings.Contains(text, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitModFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := InitModFile(dir); err != nil {
+		t.Fatalf("InitModFile 返回错误: %v", err)
+	}
+	modPath := filepath.Join(dir, "go.mod")
+	data, _ := os.ReadFile(modPath)
+	if !strings.HasPrefix(string(data), "module "+SESSION_MODULE+"\n\ngo ") {
+		t.Fatalf("go.mod 内容不符合预期: %s", data)
+	}
+
+	if err := WriteCode("module custom\n", modPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitModFile(dir); err != nil {
+		t.Fatalf("InitModFile 返回错误: %v", err)
+	}
+	if data, _ := os.ReadFile(modPath); string(data) != "module custom\n" {
+		t.Fatalf("已存在的 go.mod 不应被覆盖: %s", data)
+	}
+}
+
+// 代码在会话模块中运行，工作目录仍然是 Workspace
+func TestInputAndRunKeepsWorkspace(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	out, err := c.InputAndRun("fmt.Println(os.Getwd())")
+	if err != nil || out != GetWorkspace()+" <nil>" {
+		t.Fatalf("工作目录不符合预期: %q %v", out, err)
+	}
+}
+
+// 添加本地模块的依赖后可以导入使用
+func TestGetModuleLocalReplace(t *testing.T) {
+	prepareTestWorkspace(t)
+	local := t.TempDir()
+	if err := WriteCode("module example.com/greet\n\ngo 1.21\n", filepath.Join(local, "go.mod")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCode("package greet\n\nfunc Hello() string { return \"hello\" }\n", filepath.Join(local, "greet.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := GetModule(local)
+	if err != nil || out != "example.com/greet => "+local {
+		t.Fatalf("GetModule 结果不符合预期: %q %v", out, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(GetMainDir(), "go.mod"))
+	if !strings.Contains(string(data), "replace example.com/greet => "+local) {
+		t.Fatalf("go.mod 中缺少 replace: %s", data)
+	}
+
+	c := &Coder{}
+	if _, err := c.InputAndRun(`import "example.com/greet"`); err != nil {
+		t.Fatalf("导入本地模块返回错误: %v", err)
+	}
+	if out, err := c.InputAndRun("greet.Hello()"); err != nil || out != "hello" {
+		t.Fatalf("调用本地模块结果不符合预期: %q %v", out, err)
+	}
+}
+
+// 从本地模块缓存中添加依赖，不在缓存中时返回明确的错误
+func TestGetModuleFromCache(t *testing.T) {
+	prepareTestWorkspace(t)
+
+	if _, err := GetModule("github.com/wxnacy/go-tools@v0.0.8"); err != nil {
+		t.Fatalf("从缓存添加依赖返回错误: %v", err)
+	}
+	c := &Coder{}
+	if _, err := c.InputAndRun(`import "github.com/wxnacy/go-tools"`); err != nil {
+		t.Fatalf("导入缓存模块返回错误: %v", err)
+	}
+	if out, err := c.InputAndRun(`tools.FileExists("code.go")`); err != nil || out != "true" {
+		t.Fatalf("调用缓存模块结果不符合预期: %q %v", out, err)
+	}
+
+	_, err := GetModule("example.invalid/not-cached@v1.0.0")
+	if !errors.Is(err, errModuleNotCached) {
+		t.Fatalf("不在缓存中的模块应返回 errModuleNotCached，实际: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+// 会话文件格式的版本，格式变化时增加
+const NOTEBOOK_VERSION = 1
+
+var colorCodePattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// 保存的会话文件，通过 :save 保存，wgo --load 加载
+// 文件为 JSON 格式，比如
+//
+//	{
+//	  "version": 1,
+//	  "saved_at": "2025-11-01T10:00:00+08:00",
+//	  "imports": [{"name": "str", "path": "strings"}],
+//	  "decls": [{"name": "User", "code": "type User struct{ Name string }"}],
+//	  "cells": [
+//	    {"num": 1, "input": "u := User{Name: \"wgo\"}"},
+//	    {"num": 2, "input": "str.ToUpper(u.Name)", "output": "WGO", "has_out": true},
+//	    {"num": 3, "input": "strconv.Atoi(\"x\")", "error": "..."}
+//	  ]
+//	}
+//
+// 加载时按顺序重新运行 cells 中的输入来重建会话，imports、decls 和 output 记录保存时的结果，便于阅读和对比
+type Notebook struct {
+	Version int              `json:"version"`  // 格式版本，见 NOTEBOOK_VERSION
+	SavedAt time.Time        `json:"saved_at"` // 保存时间
+	Imports []NotebookImport `json:"imports"`  // 通过 import 语句显式导入的包，按导入顺序排列
+	Decls   []NotebookDecl   `json:"decls"`    // 包级声明，按首次声明的顺序排列
+	Cells   []NotebookCell   `json:"cells"`    // 输入记录，包括运行失败的输入
+}
+
+// 会话文件中导入的包
+type NotebookImport struct {
+	Name string `json:"name,omitempty"` // 包的别名，为空时使用包名
+	Path string `json:"path"`
+}
+
+// 会话文件中的包级声明
+type NotebookDecl struct {
+	Name string `json:"name"` // 声明的名称，方法为 类型.方法名
+	Code string `json:"code"`
+}
+
+// 会话文件中的一次输入
+type NotebookCell struct {
+	Num    int    `json:"num"`               // 输入编号，从 1 开始
+	Input  string `json:"input"`             // 输入内容
+	Output string `json:"output,omitempty"`  // 运行的输出，不含颜色
+	Error  string `json:"error,omitempty"`   // 运行失败时的错误
+	HasOut bool   `json:"has_out,omitempty"` // 是否保存了输出结果，可以通过 _n、Out[n] 引用
+}
+
+// 是否运行成功，和 InputAndRun 一样忽略部分不影响运行的错误
+func (cell NotebookCell) succeeded() bool {
+	return cell.Error == "" || isIgnoredRunError(cell.Error)
+}
+
+// 将当前会话转换为会话文件
+func (c *Coder) Notebook() *Notebook {
+	nb := &Notebook{
+		Version: NOTEBOOK_VERSION,
+		SavedAt: time.Now(),
+		Imports: make([]NotebookImport, 0, len(c.Imports)),
+		Decls:   make([]NotebookDecl, 0, len(c.DeclNames)),
+		Cells:   make([]NotebookCell, 0, len(c.Cells)),
+	}
+	for _, imp := range c.Imports {
+		nb.Imports = append(nb.Imports, NotebookImport{Name: imp.Name, Path: imp.Path})
+	}
+	for _, name := range c.DeclNames {
+		if code, ok := c.DeclCodeMap[name]; ok {
+			nb.Decls = append(nb.Decls, NotebookDecl{Name: name, Code: code})
+		}
+	}
+	for _, cell := range c.Cells {
+		nb.Cells = append(nb.Cells, NotebookCell{
+			Num:    cell.Num,
+			Input:  cell.Input,
+			Output: cell.Output,
+			Error:  cell.Error,
+			HasOut: cell.HasOut,
+		})
+	}
+	return nb
+}
+
+// 保存当前会话到文件
+// 功能需求:
+// - 按照 Notebook 的格式保存输入记录、包级声明、导入和输出，文件已经存在时覆盖
+// - 会话模式下输入只在子进程中执行，没有记录，不支持保存
+func (c *Coder) SaveNotebook(path string) error {
+	if c.session != nil {
+		return errSessionUnsupported
+	}
+	data, err := json.MarshalIndent(c.Notebook(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化会话失败: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("保存会话文件失败: %w", err)
+	}
+	logger.Infof("保存会话 %s，共 %d 个输入", path, len(c.Cells))
+	return nil
+}
+
+// 读取会话文件
+func ReadNotebook(path string) (*Notebook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取会话文件失败: %w", err)
+	}
+	nb := &Notebook{}
+	if err := json.Unmarshal(data, nb); err != nil {
+		return nil, fmt.Errorf("解析会话文件 %s 失败: %w", path, err)
+	}
+	if nb.Version < 1 || nb.Version > NOTEBOOK_VERSION {
+		return nil, fmt.Errorf("不支持的会话文件版本 %d，当前支持的版本为 %d", nb.Version, NOTEBOOK_VERSION)
+	}
+	return nb, nil
+}
+
+// 加载会话文件，重建会话的状态
+// 功能需求:
+// - 先重置当前会话，再按顺序重新运行保存的输入，输入编号、变量、声明、导入和输出结果与保存时一致
+// - 保存时运行失败的输入同样重新运行，保持输入编号不变
+// - 返回保存时运行成功、重新运行失败的输入编号，这些输入的状态没有恢复
+// - ctx 取消或者运行超时时停止加载，返回对应的错误
+func (c *Coder) LoadNotebook(ctx context.Context, path string) ([]int, error) {
+	nb, err := ReadNotebook(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Reset(); err != nil {
+		return nil, err
+	}
+	var failed []int
+	for _, cell := range nb.Cells {
+		_, err := c.InputAndRunContext(ctx, cell.Input)
+		if ctx.Err() != nil {
+			return failed, contextRunError(ctx)
+		}
+		if err != nil && !isIgnoredRunError(err.Error()) && cell.succeeded() {
+			logger.Errorf("加载会话 %s 时 In[%d] 运行失败: %v", path, cell.Num, err)
+			failed = append(failed, cell.Num)
+		}
+	}
+	logger.Infof("加载会话 %s，共 %d 个输入", path, len(nb.Cells))
+	return failed, nil
+}
+
+// 去掉文本中的颜色
+func stripColor(s string) string {
+	return colorCodePattern.ReplaceAllString(s, "")
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 保存会话后重新加载，输入编号、变量、声明、导入和输出结果都可以继续使用
+func TestSaveAndLoadNotebook(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	inputs := []string{
+		`import str "strings"`,
+		`type User struct{ Name string }`,
+		`user := User{Name: "wgo"}`,
+		`str.ToUpper(user.Name)`,
+		`undefinedVar + 1`,
+		`Out[4] + "!"`,
+	}
+	for _, input := range inputs {
+		c.InputAndRun(input)
+	}
+	path := filepath.Join(t.TempDir(), "session.wgo")
+	if err := c.SaveNotebook(path); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Notebook
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("会话文件不是合法的 JSON: %v", err)
+	}
+	if saved.Version != NOTEBOOK_VERSION || len(saved.Cells) != len(inputs) {
+		t.Fatalf("会话文件内容不符合预期: %s", data)
+	}
+	if cell := saved.Cells[3]; cell.Output != "WGO" || !cell.HasOut || cell.Error != "" {
+		t.Fatalf("输出结果没有保存: %+v", cell)
+	}
+	if cell := saved.Cells[4]; cell.Error == "" || cell.succeeded() {
+		t.Fatalf("运行失败的输入应保存错误: %+v", cell)
+	}
+	if !reflect.DeepEqual(saved.Imports, []NotebookImport{{Name: "str", Path: "strings"}}) {
+		t.Fatalf("导入没有保存: %+v", saved.Imports)
+	}
+	if len(saved.Decls) != 1 || saved.Decls[0].Name != "User" {
+		t.Fatalf("声明没有保存: %+v", saved.Decls)
+	}
+
+	loaded := &Coder{}
+	failed, err := loaded.LoadNotebook(context.Background(), path)
+	if err != nil || len(failed) > 0 {
+		t.Fatalf("加载会话失败: %v %v", failed, err)
+	}
+	if !reflect.DeepEqual(loaded.Imports, c.Imports) || !reflect.DeepEqual(loaded.DeclNames, c.DeclNames) {
+		t.Fatalf("加载后的导入、声明不一致: %+v %+v", loaded.Imports, loaded.DeclNames)
+	}
+	if len(loaded.Cells) != len(inputs) || loaded.Cells[5].Output != "WGO!" {
+		t.Fatalf("加载后的输入记录不一致: %+v", loaded.Cells)
+	}
+	if out, err := loaded.InputAndRun(`str.ToLower(user.Name) + _`); err != nil || out != "wgoWGO!" {
+		t.Fatalf("加载后的状态无法继续使用: %q %v", out, err)
+	}
+}
+
+func TestReadNotebookVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.wgo")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "cells": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadNotebook(path); err == nil || !strings.Contains(err.Error(), "99") {
+		t.Fatalf("不支持的版本应返回错误: %v", err)
+	}
+	if _, err := ReadNotebook(filepath.Join(t.TempDir(), "missing.wgo")); err == nil {
+		t.Fatal("文件不存在时应返回错误")
+	}
+}
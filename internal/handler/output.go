@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+)
+
+// stderr 的输出在开启颜色时使用灰色显示
+const colorStderr = "\033[90m"
+
+type outputFuncKey struct{}
+
+// 运行代码时实时输出的一行内容
+type OutputLine struct {
+	Text   string
+	Stderr bool // 是否是 stderr 的输出
+}
+
+// 接收实时输出的函数，在运行代码的 goroutine 中调用
+type OutputFunc func(line OutputLine)
+
+// 在 ctx 中设置接收实时输出的函数
+// 通过 ctx 运行的代码，比如 InputAndRunContext、RunCode，stdout 和 stderr 每输出一行都会调用 fn
+func WithOutputFunc(ctx context.Context, fn OutputFunc) context.Context {
+	return context.WithValue(ctx, outputFuncKey{}, fn)
+}
+
+func outputFuncFromContext(ctx context.Context) OutputFunc {
+	fn, _ := ctx.Value(outputFuncKey{}).(OutputFunc)
+	return fn
+}
+
+// 命令输出的记录
+// 功能需求:
+// - 分别保存 stdout 和 stderr，同时按照输出顺序保存合并的输出，开启颜色时 stderr 的行带颜色
+// - 按行调用 OutputFunc，命令结束时通过 flush 输出最后没有换行的内容
+type outputRecorder struct {
+	mu       sync.Mutex
+	fn       OutputFunc
+	color    bool
+	stdout   bytes.Buffer
+	stderr   bytes.Buffer
+	combined bytes.Buffer
+	pending  [2][]byte // stdout、stderr 中还没有换行的内容
+}
+
+func newOutputRecorder(fn OutputFunc, color bool) *outputRecorder {
+	return &outputRecorder{fn: fn, color: color}
+}
+
+// 获取 stdout 或 stderr 的 Writer
+func (r *outputRecorder) writer(stderr bool) io.Writer {
+	return recorderWriter{r: r, stderr: stderr}
+}
+
+type recorderWriter struct {
+	r      *outputRecorder
+	stderr bool
+}
+
+func (w recorderWriter) Write(p []byte) (int, error) {
+	w.r.write(p, w.stderr)
+	return len(p), nil
+}
+
+func (r *outputRecorder) write(p []byte, stderr bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx := 0
+	if stderr {
+		idx = 1
+		r.stderr.Write(p)
+	} else {
+		r.stdout.Write(p)
+	}
+	r.pending[idx] = append(r.pending[idx], p...)
+	for {
+		end := bytes.IndexByte(r.pending[idx], '\n')
+		if end == -1 {
+			break
+		}
+		r.emit(string(r.pending[idx][:end]), stderr)
+		r.pending[idx] = r.pending[idx][end+1:]
+	}
+}
+
+// 输出最后没有换行的内容
+func (r *outputRecorder) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for idx, pending := range r.pending {
+		if len(pending) > 0 {
+			r.emit(string(pending), idx == 1)
+			r.pending[idx] = nil
+		}
+	}
+}
+
+func (r *outputRecorder) emit(line string, stderr bool) {
+	if stderr {
+		r.combined.WriteString(colorStderrLines(line, r.color) + "\n")
+	} else {
+		r.combined.WriteString(line + "\n")
+	}
+	if r.fn != nil {
+		r.fn(OutputLine{Text: line, Stderr: stderr})
+	}
+}
+
+// 开启颜色时为 stderr 的每一行加上颜色
+func colorStderrLines(text string, color bool) string {
+	if !color {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = colorStderr + line + colorTraceReset
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 命令运行的结果
+type CommandResult struct {
+	Stdout string // 去掉首尾空白的 stdout
+	Stderr string // 去掉首尾空白的 stderr
+	Output string // 按照输出顺序合并的 stdout 和 stderr，开启颜色时 stderr 带颜色
+}
+
+func (r *outputRecorder) result() CommandResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return CommandResult{
+		Stdout: strings.TrimSpace(r.stdout.String()),
+		Stderr: strings.TrimSpace(r.stderr.String()),
+		Output: strings.TrimSpace(r.combined.String()),
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutputRecorder(t *testing.T) {
+	var lines []OutputLine
+	r := newOutputRecorder(func(line OutputLine) {
+		lines = append(lines, line)
+	}, true)
+	stdout, stderr := r.writer(false), r.writer(true)
+	stdout.Write([]byte("a\nb"))
+	stderr.Write([]byte("warn\n"))
+	stdout.Write([]byte("c\n"))
+	stdout.Write([]byte("d"))
+	r.flush()
+
+	expect := []OutputLine{{Text: "a"}, {Text: "warn", Stderr: true}, {Text: "bc"}, {Text: "d"}}
+	if !reflect.DeepEqual(lines, expect) {
+		t.Fatalf("按行输出不符合预期: %+v", lines)
+	}
+	result := r.result()
+	if result.Stdout != "a\nbc\nd" || result.Stderr != "warn" {
+		t.Fatalf("输出不符合预期: %+v", result)
+	}
+	if result.Output != "a\n"+colorStderr+"warn"+colorTraceReset+"\nbc\nd" {
+		t.Fatalf("合并的输出不符合预期: %q", result.Output)
+	}
+}
+
+// 运行中按行实时输出，退出码为 0 时 stderr 的输出不作为错误
+func TestInputAndRunStreamsOutput(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	var mu sync.Mutex
+	var lines []OutputLine
+	var firstAt time.Time
+	ctx := WithOutputFunc(context.Background(), func(line OutputLine) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstAt.IsZero() {
+			firstAt = time.Now()
+		}
+		lines = append(lines, line)
+	})
+	out, err := c.InputAndRunContext(ctx, `println("log"); for _, s := range []string{"start", "done"} { fmt.Println(s); time.Sleep(time.Second / 2) }`)
+	finishedAt := time.Now()
+	if err != nil {
+		t.Fatalf("stderr 有输出时不应返回错误: %v", err)
+	}
+	for _, expect := range []string{"start", "log", "done"} {
+		if !strings.Contains(out, expect) {
+			t.Fatalf("输出中应包含 %q: %q", expect, out)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// stdout 和 stderr 是不同的管道，只保证各自的顺序
+	var stdout, stderr []string
+	for _, line := range lines {
+		if line.Stderr {
+			stderr = append(stderr, line.Text)
+		} else {
+			stdout = append(stdout, line.Text)
+		}
+	}
+	if !reflect.DeepEqual(stdout, []string{"start", "done"}) || !reflect.DeepEqual(stderr, []string{"log"}) {
+		t.Fatalf("实时输出不符合预期: %+v", lines)
+	}
+	if finishedAt.Sub(firstAt) < 500*time.Millisecond {
+		t.Fatalf("输出应在运行结束前实时返回: %v", finishedAt.Sub(firstAt))
+	}
+}
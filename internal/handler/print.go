@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/wxnacy/go-tools"
+)
+
+// 自动打印的格式，和 BuiltinFuncCode 中的 PRINT_MODE_* 保持一致
+const (
+	PRINT_MODE_V      = "v"      // fmt.Println 的默认格式
+	PRINT_MODE_PLUS_V = "+v"     // 带字段名，%+v
+	PRINT_MODE_SHARP  = "#v"     // Go 语法表示，%#v
+	PRINT_MODE_JSON   = "json"   // 缩进的 JSON
+	PRINT_MODE_PRETTY = "pretty" // 带类型和字段名，嵌套内容缩进，默认格式
+)
+
+// 支持的打印格式列表
+func PrintModes() []string {
+	return []string{PRINT_MODE_PRETTY, PRINT_MODE_V, PRINT_MODE_PLUS_V, PRINT_MODE_SHARP, PRINT_MODE_JSON}
+}
+
+// 获取当前的打印格式
+func GetPrintMode() string {
+	if mode := GetRequest().PrintMode; mode != "" {
+		return mode
+	}
+	return PRINT_MODE_PRETTY
+}
+
+// 设置自动打印的格式，之后运行的代码生效
+func SetPrintMode(mode string) error {
+	for _, m := range PrintModes() {
+		if m == mode {
+			GetRequest().PrintMode = mode
+			return writeRequestCode()
+		}
+	}
+	return fmt.Errorf("不支持的打印格式 %s，可选: %s", mode, strings.Join(PrintModes(), ", "))
+}
+
+// 设置自动打印时是否输出颜色，交互模式下开启
+func SetPrintColor(color bool) error {
+	GetRequest().PrintColor = color
+	return writeRequestCode()
+}
+
+// 重新写入已经初始化的目录中的 request.go
+func writeRequestCode() error {
+	for _, dir := range []string{GetMainDir(), GetTempDir()} {
+		if !tools.DirExists(dir) {
+			continue
+		}
+		if err := WriteCode(GetRequest().ToCode(), filepath.Join(dir, "request.go")); err != nil {
+			return fmt.Errorf("写入 request.go 失败: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package handler
+
+import "testing"
+
+func TestSetPrintMode(t *testing.T) {
+	t.Cleanup(func() { GetRequest().PrintMode = "" })
+	if err := SetPrintMode("yaml"); err == nil {
+		t.Fatal("不支持的打印格式应返回错误")
+	}
+	if GetPrintMode() != PRINT_MODE_PRETTY {
+		t.Fatalf("默认打印格式应为 %s, 实际 %s", PRINT_MODE_PRETTY, GetPrintMode())
+	}
+	if err := SetPrintMode(PRINT_MODE_JSON); err != nil || GetPrintMode() != PRINT_MODE_JSON {
+		t.Fatalf("设置打印格式失败: %s %v", GetPrintMode(), err)
+	}
+}
+
+// 自动打印的表达式按照 PrintMode 格式化
+func TestInputAndRunPrintMode(t *testing.T) {
+	prepareTestWorkspace(t)
+	t.Cleanup(func() { GetRequest().PrintMode = "" })
+	c := &Coder{}
+	for _, input := range []string{
+		"type User struct{ Name string; Tags []string }",
+		`u := &User{Name: "wgo", Tags: []string{"go"}}`,
+	} {
+		if _, err := c.InputAndRun(input); err != nil {
+			t.Fatalf("运行 %s 返回错误: %v", input, err)
+		}
+	}
+
+	cases := []struct {
+		mode   string
+		expect string
+	}{
+		{PRINT_MODE_PRETTY, `&User{Name: "wgo", Tags: []string{"go"}}`},
+		{PRINT_MODE_V, "&{wgo [go]}"},
+		{PRINT_MODE_PLUS_V, "&{Name:wgo Tags:[go]}"},
+		{PRINT_MODE_JSON, "{\n  \"Name\": \"wgo\",\n  \"Tags\": [\n    \"go\"\n  ]\n}"},
+	}
+	for _, tc := range cases {
+		if err := SetPrintMode(tc.mode); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := c.InputAndRun("u"); err != nil || out != tc.expect {
+			t.Fatalf("%s 模式输出不符合预期:\n%s\n%v", tc.mode, out, err)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package handler
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// 子进程使用单独的进程组，取消时结束整个进程组
+// go run 编译后的程序是 go 命令的子进程，只结束 go 命令时程序会继续运行
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
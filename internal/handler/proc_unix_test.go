@@ -0,0 +1,68 @@
+//go:build !windows
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 中断时结束 go run 启动的程序，而不只是 go 命令
+func TestInputAndRunInterruptKillsProgram(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	pidPath := filepath.Join(t.TempDir(), "pid")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.InputAndRunContext(ctx, "os.WriteFile(`"+pidPath+"`, []byte(strconv.Itoa(os.Getpid())), 0o644); time.Sleep(time.Hour)")
+		errCh <- err
+	}()
+
+	var pid int
+	for deadline := time.Now().Add(time.Minute); pid == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("程序没有启动")
+		}
+		if data, err := os.ReadFile(pidPath); err == nil {
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrRunInterrupted) {
+			t.Fatalf("应返回中断错误: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("中断后应及时返回")
+	}
+	if processAlive(pid) {
+		t.Fatalf("程序 %d 应已结束", pid)
+	}
+}
+
+// 进程是否还在运行，已经结束但没有被回收的僵尸进程视为已结束
+func processAlive(pid int) bool {
+	if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+		return false
+	}
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	// 格式为 pid (comm) state ...
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package handler
+
+import "os/exec"
+
+// Windows 中没有进程组，取消时只结束子进程
+func setProcessGroup(cmd *exec.Cmd) {}
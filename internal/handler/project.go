@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wxnacy/go-tools"
+	"golang.org/x/mod/modfile"
+)
+
+var (
+	project    *Project
+	goRoot     string
+	onceGoRoot sync.Once
+)
+
+// 当前目录所在的 Go 模块
+// 项目模式下会话模块的模块名为 <Module>/wgosession，并 replace 到项目根目录，
+// 这样生成的代码可以导入项目中的包，包括根目录下 internal 中的包
+type Project struct {
+	Root   string // 项目根目录，go.mod 所在的目录
+	Module string // 项目的模块名
+
+	modFile  *modfile.File
+	onceScan sync.Once
+	packages map[string][]string // 包名 => 会话模块中可以导入的包路径
+}
+
+// 获取当前的项目，不在项目模式时返回 nil
+func GetProject() *Project {
+	return project
+}
+
+// 查找 dir 所在的 Go 模块，没有找到时返回 nil
+func FindProject(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		modPath := filepath.Join(dir, "go.mod")
+		if tools.FileExists(modPath) {
+			data, err := os.ReadFile(modPath)
+			if err != nil {
+				return nil, fmt.Errorf("读取 go.mod 失败: %w", err)
+			}
+			f, err := modfile.Parse(modPath, data, nil)
+			if err != nil {
+				return nil, fmt.Errorf("解析 go.mod 失败: %w", err)
+			}
+			if f.Module == nil {
+				return nil, fmt.Errorf("%s 没有模块名", modPath)
+			}
+			return &Project{Root: dir, Module: f.Module.Mod.Path, modFile: f}, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// 开启项目模式
+// 功能需求:
+// - 查找 Workspace 所在的 Go 模块，没有找到时不做处理
+// - 重新生成会话目录中的 go.mod
+//   - 模块名为 <项目模块名>/wgosession，按照 internal 的规则可以导入项目根目录下 internal 中的包
+//   - 依赖项目模块并 replace 到项目根目录
+//   - 复制项目 go.mod 中的 replace，相对路径转换为绝对路径
+func EnableProject() (*Project, error) {
+	p, err := FindProject(GetWorkspace())
+	if err != nil || p == nil {
+		return nil, err
+	}
+
+	f := &modfile.File{}
+	if err := f.AddModuleStmt(p.sessionModule()); err != nil {
+		return nil, err
+	}
+	if err := f.AddGoStmt(goVersion()); err != nil {
+		return nil, err
+	}
+	if err := f.AddRequire(p.Module, LOCAL_MODULE_VERSION); err != nil {
+		return nil, err
+	}
+	if err := f.AddReplace(p.Module, "", p.Root, ""); err != nil {
+		return nil, err
+	}
+	for _, r := range p.modFile.Replace {
+		newPath := r.New.Path
+		if r.New.Version == "" && !filepath.IsAbs(newPath) {
+			newPath = filepath.Join(p.Root, newPath)
+		}
+		if err := f.AddReplace(r.Old.Path, r.Old.Version, newPath, r.New.Version); err != nil {
+			return nil, err
+		}
+	}
+	data, err := f.Format()
+	if err != nil {
+		return nil, fmt.Errorf("生成 go.mod 失败: %w", err)
+	}
+	if err := os.MkdirAll(GetMainDir(), 0o755); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(GetMainDir(), "go.mod"), data, 0o644); err != nil {
+		return nil, fmt.Errorf("写入 go.mod 失败: %w", err)
+	}
+
+	project = p
+	logger.Infof("项目模式 %s %s", p.Module, p.Root)
+	return p, nil
+}
+
+// 关闭项目模式
+func DisableProject() {
+	project = nil
+}
+
+// 会话模块的模块名
+func (p *Project) sessionModule() string {
+	return p.Module + "/wgosession"
+}
+
+// 获取项目中包名为 name 且会话模块可以导入的包路径
+func (p *Project) PackagePaths(name string) []string {
+	p.onceScan.Do(func() {
+		var err error
+		if p.packages, err = p.scanPackages(); err != nil {
+			logger.Errorf("扫描项目包失败: %v", err)
+		}
+	})
+	return p.packages[name]
+}
+
+// 扫描项目中的包
+// 跳过隐藏目录、testdata、vendor、嵌套的模块以及 main 包，只保留会话模块可以导入的包
+func (p *Project) scanPackages() (map[string][]string, error) {
+	packages := make(map[string][]string)
+	importer := p.sessionModule()
+	err := filepath.WalkDir(p.Root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if dir != p.Root {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" {
+				return filepath.SkipDir
+			}
+			if tools.FileExists(filepath.Join(dir, "go.mod")) {
+				return filepath.SkipDir
+			}
+		}
+		name := packageNameInDir(dir)
+		if name == "" || name == "main" {
+			return nil
+		}
+		rel, err := filepath.Rel(p.Root, dir)
+		if err != nil {
+			return nil
+		}
+		importPath := p.Module
+		if rel != "." {
+			importPath = path.Join(p.Module, filepath.ToSlash(rel))
+		}
+		if !canImportInternal(importer, importPath) {
+			return nil
+		}
+		packages[name] = append(packages[name], importPath)
+		return nil
+	})
+	for _, paths := range packages {
+		// 路径短的优先，比如 a/handler 优先于 a/b/handler
+		sort.SliceStable(paths, func(i, j int) bool {
+			return strings.Count(paths[i], "/") < strings.Count(paths[j], "/")
+		})
+	}
+	return packages, err
+}
+
+// 读取目录中 go 文件的包名，跳过测试文件
+func packageNameInDir(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		return file.Name.Name
+	}
+	return ""
+}
+
+// 判断 importer 是否可以导入 importPath
+// internal 目录中的包只能被 internal 的父目录中的包导入
+func canImportInternal(importer, importPath string) bool {
+	elems := strings.Split(importPath, "/")
+	for i := len(elems) - 1; i >= 0; i-- {
+		if elems[i] != "internal" {
+			continue
+		}
+		parent := strings.Join(elems[:i], "/")
+		if parent != "" && importer != parent && !strings.HasPrefix(importer, parent+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// 获取代码中用到的项目包的导入
+// 功能需求:
+// - 不在项目模式时返回空
+// - 只处理代码中没有定义、没有导入、作为选择器使用的标识符，比如 handler.GetCoder() 中的 handler
+// - 和标准库包名相同的标识符交给 ImportsInFile 处理，比如 log、errors
+// - imports 中已经导入的名称不再处理
+// - 多个包同名时使用路径最短的包
+func ProjectImports(code string, imports []Import) []Import {
+	p := GetProject()
+	if p == nil {
+		return nil
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, 0)
+	if err != nil {
+		return nil
+	}
+
+	used := make(map[string]struct{})
+	for _, imp := range imports {
+		used[imp.localName()] = struct{}{}
+	}
+	for _, spec := range file.Imports {
+		if imp, ok := importFromSpec(spec); ok {
+			used[imp.localName()] = struct{}{}
+		}
+	}
+	unresolved := make(map[*ast.Ident]struct{}, len(file.Unresolved))
+	for _, ident := range file.Unresolved {
+		unresolved[ident] = struct{}{}
+	}
+
+	var result []Import
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if _, ok := unresolved[ident]; !ok {
+			return true
+		}
+		if _, ok := used[ident.Name]; ok {
+			return true
+		}
+		used[ident.Name] = struct{}{}
+		if isStdPackageName(ident.Name) {
+			return true
+		}
+		paths := p.PackagePaths(ident.Name)
+		if len(paths) == 0 {
+			return true
+		}
+		imp := Import{Path: paths[0]}
+		if path.Base(paths[0]) != ident.Name {
+			imp.Name = ident.Name
+		}
+		result = append(result, imp)
+		return true
+	})
+	return result
+}
+
+// 判断名称是否是标准库中一级包的包名
+func isStdPackageName(name string) bool {
+	onceGoRoot.Do(func() {
+		out, err := exec.Command("go", "env", "GOROOT").Output()
+		if err != nil {
+			goRoot = build.Default.GOROOT
+			return
+		}
+		goRoot = strings.TrimSpace(string(out))
+	})
+	if goRoot == "" {
+		return false
+	}
+	return tools.DirExists(filepath.Join(goRoot, "src", name))
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCanImportInternal(t *testing.T) {
+	importer := "example.com/proj/wgosession"
+	cases := map[string]bool{
+		"example.com/proj/pkg/calc":                 true,
+		"example.com/proj/internal/greet":           true,
+		"example.com/proj/internal/a/internal/b":    false,
+		"example.com/proj/pkg/calc/internal/secret": false,
+		"example.com/other/internal/x":              false,
+	}
+	for importPath, expect := range cases {
+		if got := canImportInternal(importer, importPath); got != expect {
+			t.Fatalf("%s 期望 %v, 实际 %v", importPath, expect, got)
+		}
+	}
+}
+
+// 创建一个临时项目并开启项目模式
+func enableTestProject(t *testing.T) *Project {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":                         "module example.com/proj\n\ngo 1.21\n",
+		"internal/greet/greet.go":        "package greet\n\nfunc Hello() string { return \"hello\" }\n",
+		"pkg/calc/calc.go":               "package calc\n\nfunc Add(a, b int) int { return a + b }\n",
+		"pkg/calc/internal/secret/s.go":  "package secret\n\nconst Key = \"secret\"\n",
+		"cmd/app/main.go":                "package main\n\nfunc main() {}\n",
+		"testdata/fake/fake.go":          "package fake\n",
+		"internal/greet/greet_test.go":   "package greet_test\n",
+		"internal/greet/internal/x/x.go": "package x\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteCode(content, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	workspace := GetRequest().Workspace
+	GetRequest().Workspace = root
+	t.Cleanup(func() {
+		GetRequest().Workspace = workspace
+		DisableProject()
+	})
+	prepareTestWorkspace(t)
+
+	p, err := EnableProject()
+	if err != nil || p == nil {
+		t.Fatalf("EnableProject 返回错误: %v", err)
+	}
+	return p
+}
+
+func TestProjectPackagePaths(t *testing.T) {
+	p := enableTestProject(t)
+	if p.Module != "example.com/proj" {
+		t.Fatalf("模块名不符合预期: %s", p.Module)
+	}
+	if paths := p.PackagePaths("greet"); !reflect.DeepEqual(paths, []string{"example.com/proj/internal/greet"}) {
+		t.Fatalf("greet 包路径不符合预期: %v", paths)
+	}
+	if paths := p.PackagePaths("calc"); !reflect.DeepEqual(paths, []string{"example.com/proj/pkg/calc"}) {
+		t.Fatalf("calc 包路径不符合预期: %v", paths)
+	}
+	for _, name := range []string{"secret", "x", "main", "fake"} {
+		if paths := p.PackagePaths(name); len(paths) != 0 {
+			t.Fatalf("%s 不应可以导入: %v", name, paths)
+		}
+	}
+
+	data, _ := os.ReadFile(filepath.Join(GetMainDir(), "go.mod"))
+	if !strings.Contains(string(data), "module example.com/proj/wgosession") ||
+		!strings.Contains(string(data), "replace example.com/proj => "+p.Root) {
+		t.Fatalf("会话 go.mod 不符合预期: %s", data)
+	}
+}
+
+// 项目模式下可以直接使用项目中的包，并遵守 internal 的规则
+func TestInputAndRunProjectPackages(t *testing.T) {
+	enableTestProject(t)
+	c := &Coder{}
+
+	if out, err := c.InputAndRun("greet.Hello()"); err != nil || out != "hello" {
+		t.Fatalf("调用 internal 包结果不符合预期: %q %v", out, err)
+	}
+	if out, err := c.InputAndRun("calc.Add(1, 2)"); err != nil || out != "3" {
+		t.Fatalf("调用项目包结果不符合预期: %q %v", out, err)
+	}
+	_, err := c.InputAndRun(`import "example.com/proj/pkg/calc/internal/secret"`)
+	if err == nil || !strings.Contains(err.Error(), "internal") {
+		t.Fatalf("不可见的 internal 包应返回错误: %v", err)
+	}
+}
@@ -51,20 +51,34 @@ type Request struct {
 	MainDir   string
 	MainFile  string
 	TempDir   string
+
+	PrintMode  string // 自动打印的格式，见 PRINT_MODE_*
+	PrintColor bool   // 自动打印时是否输出颜色
 }
 
 func (r Request) ToCode() string {
 	tpl := `package main
 
+import "os"
+
 func init() {
-	RequestID = "%s"
-	TempDir = "%s"
+	RequestID = %q
+	TempDir = %q
+	PrintMode = %q
+	PrintColor = %t
+	// 代码在 MainDir 的会话模块中编译运行，切换回工作目录，保证相对路径和在工作目录中运行时一致
+	if workspace := %q; workspace != "" {
+		os.Chdir(workspace)
+	}
 }
 `
 	return fmt.Sprintf(
 		tpl,
 		r.ID,
 		r.TempDir,
+		r.PrintMode,
+		r.PrintColor,
+		r.Workspace,
 	)
 }
 
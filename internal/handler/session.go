@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errSessionExited = errors.New("会话进程已退出")
+
+// 长驻的会话子进程
+// 子进程使用解释器保存所有状态，每次输入只执行新的代码片段
+type Session struct {
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	requests *os.File
+	stdout   *bufio.Reader
+	stderr   *bufio.Reader
+	marker   string
+	done     chan struct{}
+}
+
+// 启动会话子进程
+// 功能需求:
+// - 使用当前可执行文件的 session 子命令启动子进程
+// - 请求通过额外的管道（子进程中的第 3 个文件描述符）发送
+// - stdout/stderr 作为代码的输出读取
+// - 每个会话随机生成输出分隔标记，通过环境变量传给子进程
+func StartSession() (*Session, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("获取可执行文件失败: %w", err)
+	}
+	marker, err := newSessionMarker()
+	if err != nil {
+		return nil, fmt.Errorf("生成会话分隔标记失败: %w", err)
+	}
+
+	reqR, reqW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建会话管道失败: %w", err)
+	}
+	defer reqR.Close()
+
+	cmd := exec.Command(exe, SESSION_COMMAND)
+	cmd.ExtraFiles = []*os.File{reqR}
+	cmd.Env = append(os.Environ(), sessionMarkerEnv+"="+marker)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		reqW.Close()
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		reqW.Close()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		reqW.Close()
+		return nil, fmt.Errorf("启动会话进程失败: %w", err)
+	}
+	logger.Infof("会话进程已启动 pid %d", cmd.Process.Pid)
+
+	s := &Session{
+		cmd:      cmd,
+		requests: reqW,
+		stdout:   bufio.NewReader(stdout),
+		stderr:   bufio.NewReader(stderr),
+		marker:   marker,
+		done:     make(chan struct{}),
+	}
+	go func() {
+		err := cmd.Wait()
+		logger.Infof("会话进程已退出: %v", err)
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// 在会话子进程中执行代码
+// 返回值的语义和 RunCommand 保持一致：执行出错时返回错误，代码在 stderr 中的输出和 stdout 一起返回，开启颜色时带颜色
+// ctx 取消或超时时结束子进程，返回 errSessionExited
+func (s *Session) Eval(ctx context.Context, code string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.cmd.Process.Kill()
+		case <-finished:
+		}
+	}()
+
+	data, err := json.Marshal(sessionRequest{Code: code})
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.requests.Write(append(data, '\n')); err != nil {
+		return "", fmt.Errorf("%w: %w", errSessionExited, err)
+	}
+
+	type result struct {
+		text string
+		err  error
+	}
+	errCh := make(chan result, 1)
+	go func() {
+		text, _, err := readSessionOutput(s.stderr, s.marker)
+		errCh <- result{text, err}
+	}()
+	out, payload, outErr := readSessionOutput(s.stdout, s.marker)
+	errOut := <-errCh
+	if outErr != nil || errOut.err != nil {
+		return strings.TrimSpace(out), fmt.Errorf("%w: %s", errSessionExited, strings.TrimSpace(errOut.text))
+	}
+
+	var resp sessionResponse
+	if err := json.Unmarshal([]byte(payload), &resp); err != nil {
+		return "", fmt.Errorf("解析会话响应失败: %w", err)
+	}
+
+	out = strings.TrimSpace(out)
+	errText := strings.TrimSpace(errOut.text)
+	if resp.Err != "" {
+		if errText != "" {
+			return out, errors.New(errText + "\n" + resp.Err)
+		}
+		return out, errors.New(resp.Err)
+	}
+	if errText != "" {
+		out = strings.TrimSpace(out + "\n" + colorStderrLines(errText, GetRequest().PrintColor))
+	}
+	return out, nil
+}
+
+// 关闭会话子进程
+// 关闭请求管道后子进程会自行退出，超时未退出则强制结束
+func (s *Session) Close() error {
+	s.requests.Close()
+	select {
+	case <-s.done:
+	case <-time.After(2 * time.Second):
+		if err := s.cmd.Process.Kill(); err != nil {
+			return err
+		}
+		<-s.done
+	}
+	return nil
+}
+
+// 生成会话输出分隔标记
+// 使用随机数避免和代码输出冲突
+func newSessionMarker() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return "\x1ewgo-session-" + hex.EncodeToString(nonce) + "\x1e", nil
+}
+
+// 读取一次执行的输出，直到遇到分隔标记
+// 返回标记前的代码输出和标记后的响应内容
+func readSessionOutput(r *bufio.Reader, marker string) (string, string, error) {
+	var sb strings.Builder
+	last := marker[len(marker)-1]
+	for {
+		chunk, err := r.ReadString(last)
+		sb.WriteString(chunk)
+		if err != nil {
+			return sb.String(), "", err
+		}
+		if strings.HasSuffix(sb.String(), marker) {
+			break
+		}
+	}
+	text := strings.TrimSuffix(sb.String(), marker)
+	payload, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return text, "", err
+	}
+	return text, strings.TrimSuffix(payload, "\n"), nil
+}
+
+// 开启会话模式
+// 开启后 InputAndRun 不再重写并 go run 整个 main 文件，而是交给会话子进程执行
+func (c *Coder) StartSession() error {
+	if c.session != nil {
+		return nil
+	}
+	s, err := StartSession()
+	if err != nil {
+		return err
+	}
+	c.session = s
+	return nil
+}
+
+// 关闭会话模式
+func (c *Coder) CloseSession() error {
+	if c.session == nil {
+		return nil
+	}
+	err := c.session.Close()
+	c.session = nil
+	return err
+}
+
+// 是否处于会话模式
+func (c *Coder) IsSession() bool {
+	return c.session != nil
+}
+
+// 在会话中执行输入
+// 子进程意外退出时（比如代码中调用 os.Exit）自动重启会话，之前的状态会丢失
+// 中断或超时时同样会结束并重启子进程
+func (c *Coder) evalInSession(ctx context.Context, input string) (string, error) {
+	ctx, cancel := withRunTimeout(ctx)
+	defer cancel()
+	c.sessionRuns++
+	out, err := c.session.Eval(ctx, input)
+	if err != nil && errors.Is(err, errSessionExited) {
+		if ctxErr := contextRunError(ctx); ctxErr != nil {
+			err = ctxErr
+		}
+		c.session.Close()
+		c.session = nil
+		if startErr := c.StartSession(); startErr != nil {
+			return out, fmt.Errorf("%w，重启会话失败: %w", err, startErr)
+		}
+		return out, fmt.Errorf("%w，会话已重新启动，之前的状态已丢失", err)
+	}
+	return out, err
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+	"github.com/traefik/yaegi/stdlib/unrestricted"
+	"golang.org/x/tools/imports"
+)
+
+const (
+	SESSION_COMMAND = "session"
+	// 父进程通过该环境变量把本次会话的分隔标记传给子进程
+	sessionMarkerEnv = "WGO_SESSION_MARKER"
+)
+
+type sessionRequest struct {
+	Code string `json:"code"`
+}
+
+type sessionResponse struct {
+	Err string `json:"err,omitempty"`
+}
+
+// 会话子进程入口
+// 请求从父进程传入的第 3 个文件描述符读取，代码输出直接写入 stdout/stderr
+func RunSessionChild() error {
+	requests := os.NewFile(3, "wgo-session-requests")
+	if requests == nil {
+		return fmt.Errorf("无法打开会话请求管道")
+	}
+	defer requests.Close()
+	marker := os.Getenv(sessionMarkerEnv)
+	if marker == "" {
+		return fmt.Errorf("缺少会话分隔标记 %s", sessionMarkerEnv)
+	}
+	return ServeSession(requests, os.Stdout, os.Stderr, marker)
+}
+
+// 运行会话子进程的主循环
+// 功能需求:
+// - 从 requests 中按行读取 JSON 请求，使用 yaegi 解释器执行代码片段，变量、函数和类型都保存在解释器中
+// - 只执行本次输入的代码，之前的输入不会重新执行
+// - 自动导入代码片段中用到但还未导入的包
+// - 最后一条语句是有返回值的表达式时自动打印结果
+// - 每次执行结束后向 stdout 写入标记和响应，向 stderr 写入标记，便于父进程切分输出
+// - 标记由父进程为每个会话随机生成，代码输出中出现任意字节都不会被误认为标记
+// - 注意：子进程中不能打印日志，日志默认输出到 stderr 会混入代码输出
+func ServeSession(requests io.Reader, stdout, stderr io.Writer, marker string) error {
+	s, err := newSessionState(stdout, stderr)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(requests)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var req sessionRequest
+		var resp sessionResponse
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Err = fmt.Sprintf("解析会话请求失败: %v", err)
+		} else if err := s.run(req.Code); err != nil {
+			resp.Err = err.Error()
+		}
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(stdout, "%s%s\n", marker, data); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(stderr, "%s\n", marker); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+type sessionState struct {
+	interp   *interp.Interpreter
+	stdout   io.Writer
+	imported map[string]struct{}
+}
+
+func newSessionState(stdout, stderr io.Writer) (*sessionState, error) {
+	i := interp.New(interp.Options{
+		Stdout:       stdout,
+		Stderr:       stderr,
+		Unrestricted: true,
+	})
+	for _, symbols := range []interp.Exports{stdlib.Symbols, unrestricted.Symbols} {
+		if err := i.Use(symbols); err != nil {
+			return nil, fmt.Errorf("加载解释器标准库失败: %w", err)
+		}
+	}
+	return &sessionState{
+		interp:   i,
+		stdout:   stdout,
+		imported: make(map[string]struct{}),
+	}, nil
+}
+
+// 执行一段代码
+func (s *sessionState) run(code string) error {
+	if strings.TrimSpace(code) == "" {
+		return nil
+	}
+	for _, path := range sessionMissingImports(code) {
+		if _, ok := s.imported[path]; ok {
+			continue
+		}
+		if _, err := s.interp.Eval(fmt.Sprintf("import %q", path)); err != nil {
+			return err
+		}
+		s.imported[path] = struct{}{}
+	}
+
+	value, err := s.interp.Eval(code)
+	if err != nil {
+		return err
+	}
+	shouldPrint, callee := sessionShouldPrint(code)
+	if !value.IsValid() || !shouldPrint {
+		return nil
+	}
+	// 没有返回值的函数调用不打印
+	if callee != "" {
+		if fn, err := s.interp.Eval(callee); err == nil && fn.Kind() == reflect.Func && fn.Type().NumOut() == 0 {
+			return nil
+		}
+	}
+	fmt.Fprintln(s.stdout, sessionValueString(value))
+	return nil
+}
+
+// 解析会话代码
+// 优先按包级声明解析（func、type、import 等），失败后再按 main 函数中的语句解析
+func parseSessionCode(code string) (*ast.File, bool) {
+	fset := token.NewFileSet()
+	if file, err := parser.ParseFile(fset, "", "package main\n"+code, 0); err == nil {
+		return file, true
+	}
+	file, err := parser.ParseFile(fset, "", "package main\nfunc main() {\n"+code+"\n}", 0)
+	if err != nil {
+		return nil, false
+	}
+	return file, false
+}
+
+// 获取代码中用到但没有导入的包
+func sessionMissingImports(code string) []string {
+	file, isDecl := parseSessionCode(code)
+	if file == nil {
+		return nil
+	}
+	src := "package main\n" + code
+	if !isDecl {
+		src = "package main\nfunc main() {\n" + code + "\n}"
+	}
+	fixed, err := imports.Process("session.go", []byte(src), nil)
+	if err != nil {
+		return nil
+	}
+	fixedFile, err := parser.ParseFile(token.NewFileSet(), "", fixed, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+
+	existing := make(map[string]struct{})
+	for _, imp := range file.Imports {
+		existing[imp.Path.Value] = struct{}{}
+	}
+	var paths []string
+	for _, imp := range fixedFile.Imports {
+		if _, ok := existing[imp.Path.Value]; ok {
+			continue
+		}
+		// 带别名的导入只会由用户显式输入，这里只处理自动补全的导入
+		if imp.Name != nil {
+			continue
+		}
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// 判断是否需要自动打印执行结果
+// 规则和 JoinPrintCode 保持一致：只打印最后一条表达式语句，fmt.Print 等打印函数不再重复打印
+// 最后一条语句是函数调用时，同时返回调用的函数名（选择器链），用于判断函数是否有返回值
+func sessionShouldPrint(code string) (bool, string) {
+	file, isDecl := parseSessionCode(code)
+	if file == nil || isDecl {
+		return false, ""
+	}
+	mainFunc := findMainFunc(file)
+	if mainFunc == nil || mainFunc.Body == nil || len(mainFunc.Body.List) == 0 {
+		return false, ""
+	}
+	exprStmt, ok := mainFunc.Body.List[len(mainFunc.Body.List)-1].(*ast.ExprStmt)
+	if !ok {
+		return false, ""
+	}
+	call, ok := exprStmt.X.(*ast.CallExpr)
+	if !ok {
+		return true, ""
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), call.Fun); err != nil {
+		return true, ""
+	}
+	name := extractFuncChain(buf.String())
+	for _, prefix := range []string{"fmt.Print", "fmt.Fprint", "log.Print", "log.Fatal", "log.Panic"} {
+		if strings.HasPrefix(name, prefix) {
+			return false, ""
+		}
+	}
+	return true, name
+}
+
+func sessionValueString(value reflect.Value) string {
+	if value.CanInterface() {
+		return fmt.Sprint(value.Interface())
+	}
+	return value.String()
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// 测试二进制作为会话子进程运行时，直接进入会话主循环
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == SESSION_COMMAND {
+		if err := RunSessionChild(); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func startTestSession(t *testing.T) *Coder {
+	t.Helper()
+	c := &Coder{}
+	if err := c.StartSession(); err != nil {
+		t.Fatalf("StartSession 返回错误: %v", err)
+	}
+	t.Cleanup(func() { c.CloseSession() })
+	return c
+}
+
+func mustRun(t *testing.T, c *Coder, input string) string {
+	t.Helper()
+	out, err := c.InputAndRun(input)
+	if err != nil {
+		t.Fatalf("运行 %q 返回错误: %v", input, err)
+	}
+	return out
+}
+
+// 会话模式下状态保存在子进程中，之前的输入不会被重新执行
+func TestSessionKeepsStateWithoutReplay(t *testing.T) {
+	c := startTestSession(t)
+
+	mustRun(t, c, "count := 0")
+	mustRun(t, c, `inc := func() int { count++; fmt.Println("called"); return count }`)
+
+	if out := mustRun(t, c, "inc()"); out != "called\n1" {
+		t.Fatalf("第一次调用输出不符合预期: %q", out)
+	}
+	if out := mustRun(t, c, "inc()"); out != "called\n2" {
+		t.Fatalf("第二次调用输出不符合预期，副作用可能被重复执行: %q", out)
+	}
+	if out := mustRun(t, c, "count"); out != "2" {
+		t.Fatalf("count 应为 2，实际: %q", out)
+	}
+}
+
+// 会话模式支持包级声明并自动导入标准库
+func TestSessionDeclarationsAndImports(t *testing.T) {
+	c := startTestSession(t)
+
+	mustRun(t, c, "type User struct{ Name string }")
+	mustRun(t, c, "func hello(u User) string { return strings.ToUpper(u.Name) }")
+	if out := mustRun(t, c, `hello(User{Name: "wgo"})`); out != "WGO" {
+		t.Fatalf("调用声明的函数输出不符合预期: %q", out)
+	}
+	if out := mustRun(t, c, `fmt.Println("hi")`); out != "hi" {
+		t.Fatalf("fmt.Println 不应重复打印返回值: %q", out)
+	}
+}
+
+// 运行错误返回给调用方，会话继续可用
+func TestSessionErrorKeepsSession(t *testing.T) {
+	c := startTestSession(t)
+
+	mustRun(t, c, "a := 1")
+	if _, err := c.InputAndRun("undefinedName + 1"); err == nil {
+		t.Fatal("未定义的变量应返回错误")
+	}
+	if out := mustRun(t, c, "a + 1"); out != "2" {
+		t.Fatalf("错误后会话状态应保留: %q", out)
+	}
+}
+
+// 子进程退出后自动重启会话
+func TestSessionRestartAfterExit(t *testing.T) {
+	c := startTestSession(t)
+
+	_, err := c.InputAndRun("os.Exit(3)")
+	if err == nil || !strings.Contains(err.Error(), errSessionExited.Error()) {
+		t.Fatalf("子进程退出应返回 errSessionExited，实际: %v", err)
+	}
+	if out := mustRun(t, c, "1 + 1"); out != "2" {
+		t.Fatalf("重启后的会话应可用: %q", out)
+	}
+}
+
+// 代码输出中包含 0x1e 等控制字节时不会截断响应，会话保持同步
+func TestSessionOutputWithSeparatorByte(t *testing.T) {
+	c := startTestSession(t)
+
+	if out := mustRun(t, c, `fmt.Print("a\x1eb\x1e")`); out != "a\x1eb\x1e" {
+		t.Fatalf("输出中的 0x1e 不应被当作分隔标记: %q", out)
+	}
+	if out := mustRun(t, c, `fmt.Fprint(os.Stderr, "\x1e")`); out != "\x1e" {
+		t.Fatalf("stderr 中的 0x1e 不应被当作分隔标记: %q", out)
+	}
+	if out := mustRun(t, c, "1 + 1"); out != "2" {
+		t.Fatalf("之后的输入应得到自己的输出: %q", out)
+	}
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync"
+)
+
+var stdinFile string // 预先读入 stdin 的文件，为空时不使用
+
+type stdinKey struct{}
+
+// 在 ctx 中设置运行代码时的 stdin
+// 通过 ctx 运行的代码，比如 InputAndRunContext、RunCode，可以从 r 中读取输入，比如 fmt.Scanln
+func WithStdin(ctx context.Context, r io.Reader) context.Context {
+	return context.WithValue(ctx, stdinKey{}, r)
+}
+
+func stdinFromContext(ctx context.Context) io.Reader {
+	r, _ := ctx.Value(stdinKey{}).(io.Reader)
+	return r
+}
+
+// 设置预先读入 stdin 的文件，每次运行代码都从文件开头读取，便于重复运行
+// path 为空时取消设置
+func SetStdinFile(path string) error {
+	if path != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("读取 stdin 文件失败: %w", err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("stdin 文件 %s 是一个目录", path)
+		}
+		logger.Infof("使用 stdin 文件 %s", path)
+	}
+	stdinFile = path
+	return nil
+}
+
+// 获取预先读入 stdin 的文件
+func GetStdinFile() string {
+	return stdinFile
+}
+
+// 设置了 stdin 文件时，打开文件作为 ctx 中的 stdin，返回关闭文件的方法
+func withStdinFile(ctx context.Context) (context.Context, func(), error) {
+	if stdinFile == "" {
+		return ctx, func() {}, nil
+	}
+	f, err := os.Open(stdinFile)
+	if err != nil {
+		return ctx, func() {}, fmt.Errorf("打开 stdin 文件失败: %w", err)
+	}
+	return WithStdin(ctx, f), func() { f.Close() }, nil
+}
+
+// 将 ctx 中的 stdin 连接到命令，返回命令结束后的清理方法
+// 功能需求:
+// - 文件、管道直接作为命令的 stdin
+// - 终端通过管道转发：命令在单独的进程组中运行，直接读取终端会被暂停
+// - 其他 Reader 同样通过管道转发，命令结束后关闭管道，不等待转发结束，避免 Wait 一直等待读取
+// - 转发通过同一个 Reader 共享的 stdinPump 读取，命令结束后不再读取，没有发送给命令的输入留给之后的运行
+func attachStdin(ctx context.Context, cmd *exec.Cmd) (func(), error) {
+	r := stdinFromContext(ctx)
+	if r == nil {
+		return func() {}, nil
+	}
+	if f, ok := r.(*os.File); ok && !isTerminal(f) {
+		cmd.Stdin = f
+		return func() {}, nil
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建 stdin 管道失败: %w", err)
+	}
+	cmd.Stdin = pr
+	pump := getStdinPump(r)
+	done := make(chan struct{})
+	go func() {
+		pump.forward(pw, done)
+		pw.Close()
+	}()
+	return func() {
+		close(done)
+		pr.Close()
+		pw.Close()
+	}, nil
+}
+
+var (
+	stdinPumps   = map[io.Reader]*stdinPump{}
+	stdinPumpsMu sync.Mutex
+)
+
+// 持续读取一个 Reader 的输入，分发给正在运行的命令
+// 对 Reader 的读取不能中断，比如终端和 os.Stdin，所以同一个 Reader 只在一个 goroutine 中读取，
+// 读取的内容交给当前运行的命令，命令结束后不会再读取输入
+type stdinPump struct {
+	r      io.Reader
+	chunks chan []byte // 读取到的输入，读取结束后关闭
+
+	mu     sync.Mutex
+	unread []byte // 已经读取但没有发送给命令的输入
+}
+
+// 获取 Reader 共享的 stdinPump，不存在时创建并开始读取
+func getStdinPump(r io.Reader) *stdinPump {
+	stdinPumpsMu.Lock()
+	defer stdinPumpsMu.Unlock()
+	comparable := reflect.TypeOf(r).Comparable()
+	if comparable {
+		if p, ok := stdinPumps[r]; ok {
+			return p
+		}
+	}
+	p := &stdinPump{r: r, chunks: make(chan []byte)}
+	if comparable {
+		stdinPumps[r] = p
+	}
+	go p.pump()
+	return p
+}
+
+func (p *stdinPump) pump() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := p.r.Read(buf)
+		if n > 0 {
+			p.chunks <- append([]byte(nil), buf[:n]...)
+		}
+		if err != nil {
+			close(p.chunks)
+			return
+		}
+	}
+}
+
+// 将输入写入 w，直到 done 关闭或者读取结束
+// 写入失败时，比如命令已经结束，没有写入的输入留给之后的运行
+func (p *stdinPump) forward(w io.Writer, done <-chan struct{}) {
+	for {
+		data, ok := p.next(done)
+		if !ok {
+			return
+		}
+		n, err := w.Write(data)
+		if err != nil {
+			p.putBack(data[n:])
+			return
+		}
+	}
+}
+
+// 获取下一段输入，done 关闭或者读取结束时返回 false
+func (p *stdinPump) next(done <-chan struct{}) ([]byte, bool) {
+	p.mu.Lock()
+	if len(p.unread) > 0 {
+		data := p.unread
+		p.unread = nil
+		p.mu.Unlock()
+		return data, true
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil, false
+	case data, ok := <-p.chunks:
+		if !ok {
+			p.release()
+			return nil, false
+		}
+		select {
+		case <-done:
+			p.putBack(data)
+			return nil, false
+		default:
+		}
+		return data, true
+	}
+}
+
+func (p *stdinPump) putBack(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unread = append(append([]byte(nil), data...), p.unread...)
+}
+
+// 读取结束后不再保存，之后的运行重新从 Reader 中读取，比如直接得到 EOF
+func (p *stdinPump) release() {
+	if !reflect.TypeOf(p.r).Comparable() {
+		return
+	}
+	stdinPumpsMu.Lock()
+	defer stdinPumpsMu.Unlock()
+	if stdinPumps[p.r] == p {
+		delete(stdinPumps, p.r)
+	}
+}
+
+// 文件是否是终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 运行的代码可以读取 ctx 中设置的 stdin
+func TestInputAndRunReadsStdin(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	ctx := WithStdin(context.Background(), strings.NewReader("wgo\n"))
+	out, err := c.InputAndRunContext(ctx, "var name string; _, _ = fmt.Scanln(&name); name")
+	if err != nil || out != "wgo" {
+		t.Fatalf("读取 stdin 结果不符合预期: %q %v", out, err)
+	}
+	// 没有设置 stdin 时读取到 EOF
+	if out, err := c.InputAndRun("var s string; _, err := fmt.Scanln(&s); err"); err != nil || !strings.Contains(out, "EOF") {
+		t.Fatalf("没有 stdin 时应读取到 EOF: %q %v", out, err)
+	}
+}
+
+// 每次运行都从 stdin 文件开头读取
+func TestInputAndRunStdinFile(t *testing.T) {
+	prepareTestWorkspace(t)
+	path := filepath.Join(t.TempDir(), "stdin.txt")
+	if err := os.WriteFile(path, []byte("21\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetStdinFile(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetStdinFile("") })
+	c := &Coder{}
+	for i := 0; i < 2; i++ {
+		if out, err := c.InputAndRun("var n int; _, _ = fmt.Scan(&n); n * 2"); err != nil || out != "42" {
+			t.Fatalf("第 %d 次运行结果不符合预期: %q %v", i+1, out, err)
+		}
+	}
+	if err := SetStdinFile(filepath.Join(t.TempDir(), "not-exist.txt")); err == nil {
+		t.Fatal("文件不存在时应返回错误")
+	}
+}
+
+// 连续两次运行读取同一个 stdin，上一次运行结束后不会再读取之后的输入
+func TestInputAndRunSharedStdin(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	r, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithTimeout(WithStdin(context.Background(), r), time.Minute)
+	defer cancel()
+
+	for _, line := range []string{"first", "second"} {
+		go io.WriteString(w, line+"\n")
+		out, err := c.InputAndRunContext(ctx, "var line string; _, _ = fmt.Scanln(&line); line")
+		if err != nil || out != line {
+			t.Fatalf("读取 stdin 结果不符合预期，期望 %q: %q %v", line, out, err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	colorTraceMessage  = "\033[31m"
+	colorTraceLocation = "\033[33m"
+	colorTraceFunc     = "\033[36m"
+	colorTraceReset    = "\033[0m"
+)
+
+var (
+	goroutineHeaderPattern = regexp.MustCompile(`^goroutine \d+ \[.*\]:$`)
+	traceFilePattern       = regexp.MustCompile(`^\t(.+?):(\d+)(?: \+0x[0-9a-f]+)?$`)
+	exitStatusPattern      = regexp.MustCompile(`^exit status \d+$`)
+	// 会话代码中生成的变量恢复和保存代码
+	replayCodePattern = regexp.MustCompile(`\b_(Deserialize|Serialize|SerializeFunc)\b`)
+	// main 函数以及其中的函数字面量，调用栈中不显示函数名
+	mainFuncPattern = regexp.MustCompile(`^main\.main(\.func\d+)*$`)
+)
+
+// panic 调用栈中的一帧
+type TraceFrame struct {
+	Func string // 函数名，比如 main.main、strings.Repeat
+	File string // 文件地址
+	Line int    // 文件中的行号
+
+	Cell     int    // 对应的输入编号，为 0 时不是输入的代码
+	CellLine int    // 在输入中的行号，从 1 开始
+	Code     string // 对应的代码
+}
+
+// 解析 panic 的输出
+// 功能需求:
+// - 支持 panic: 和 fatal error: 开头的输出，之前的内容是程序自己的错误输出，一起作为消息
+// - 只解析第一个 goroutine 的调用栈，也就是发生 panic 的 goroutine
+// - 忽略 go run 输出的 exit status
+func parsePanic(errText string) (message string, frames []TraceFrame, ok bool) {
+	lines := strings.Split(errText, "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return "", nil, false
+	}
+	header := -1
+	for i := start; i < len(lines); i++ {
+		if goroutineHeaderPattern.MatchString(lines[i]) {
+			header = i
+			break
+		}
+	}
+	if header == -1 {
+		return "", nil, false
+	}
+	message = strings.TrimSpace(strings.Join(lines[:header], "\n"))
+
+	for i := header + 1; i+1 < len(lines); i += 2 {
+		funcLine := lines[i]
+		if strings.TrimSpace(funcLine) == "" || exitStatusPattern.MatchString(funcLine) {
+			break
+		}
+		matches := traceFilePattern.FindStringSubmatch(lines[i+1])
+		if matches == nil {
+			break
+		}
+		line, _ := strconv.Atoi(matches[2])
+		frames = append(frames, TraceFrame{Func: traceFuncName(funcLine), File: matches[1], Line: line})
+	}
+	return message, frames, true
+}
+
+// 去掉函数的参数，比如 main.at(...) => main.at
+func traceFuncName(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "created by ") {
+		line = strings.TrimPrefix(line, "created by ")
+		if idx := strings.Index(line, " in goroutine"); idx != -1 {
+			line = line[:idx]
+		}
+		return "created by " + line
+	}
+	if idx := strings.LastIndex(line, "("); idx > 0 {
+		line = line[:idx]
+	}
+	return line
+}
+
+// 将 panic 的输出格式化为对应到输入的调用栈
+// 功能需求:
+// - 去掉 builtin_func.go、request.go 中的帧，以及恢复、保存变量的代码和 runtime 中的帧
+// - main 文件中的帧通过代码内容对应到输入编号和输入中的行号，最近的输入优先
+// - 输出紧凑的调用栈，开启颜色时消息为红色，位置为黄色，函数名为青色
+//   - panic: runtime error: index out of range [5] with length 2
+//   - In[2]:2 at: return xs[i]
+//   - In[3]:1 at(xs, 5)
+//
+// - 不是 panic 的输出返回 false
+func (c *Coder) formatPanic(code, errText string) (string, bool) {
+	message, frames, ok := parsePanic(errText)
+	if !ok {
+		return errText, false
+	}
+	codeLines := strings.Split(code, "\n")
+	mainFile := GetMainFile()
+	mainDir := filepath.Dir(mainFile)
+
+	var kept []TraceFrame
+	for _, frame := range frames {
+		if strings.HasPrefix(frame.Func, "runtime.") || strings.HasPrefix(frame.Func, "created by ") {
+			continue
+		}
+		if filepath.Dir(frame.File) == mainDir && filepath.Base(frame.File) != filepath.Base(mainFile) {
+			// builtin_func.go、request.go 等生成的文件
+			continue
+		}
+		if frame.File == mainFile {
+			frame.Code = lookupCodeLine(codeLines, frame.Line)
+			if replayCodePattern.MatchString(frame.Code) {
+				continue
+			}
+			if cell, line, input := c.lookupCellLine(frame.Code); cell > 0 {
+				frame.Cell, frame.CellLine, frame.Code = cell, line, input
+			}
+		}
+		kept = append(kept, frame)
+	}
+
+	color := GetRequest().PrintColor
+	paint := func(colorCode, s string) string {
+		if !color {
+			return s
+		}
+		return colorCode + s + colorTraceReset
+	}
+	var b strings.Builder
+	b.WriteString(paint(colorTraceMessage, message))
+	for _, frame := range kept {
+		b.WriteString("\n  ")
+		name := strings.TrimPrefix(frame.Func, "main.")
+		switch {
+		case frame.Cell > 0:
+			b.WriteString(paint(colorTraceLocation, fmt.Sprintf("In[%d]:%d", frame.Cell, frame.CellLine)))
+			if !mainFuncPattern.MatchString(frame.Func) {
+				b.WriteString(" " + paint(colorTraceFunc, name) + ":")
+			}
+			b.WriteString(" " + frame.Code)
+		case frame.Code != "":
+			b.WriteString(paint(colorTraceLocation, fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)))
+			b.WriteString(" " + paint(colorTraceFunc, name) + ": " + frame.Code)
+		default:
+			b.WriteString(paint(colorTraceLocation, fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)))
+			b.WriteString(" " + paint(colorTraceFunc, frame.Func))
+		}
+	}
+	return b.String(), true
+}
+
+// 查找代码所在的输入编号、输入中的行号以及该行输入，没有找到时返回 0
+// 从最近的输入开始查找，去掉空白后比较，优先级如下
+//   - 代码和输入的行相同
+//   - 代码包含输入的行，比如自动打印的封装 _Print(a/b)
+//   - 输入的行包含代码，比如一行输入的函数字面量格式化后变为多行
+//
+// 只有括号等符号的行不参与比较
+func (c *Coder) lookupCellLine(code string) (int, int, string) {
+	target := stripCodeSpace(strings.TrimSuffix(strings.TrimSpace(code), INPUT_SUFFIX))
+	if !hasCodeWord(target) {
+		return 0, 0, ""
+	}
+	for i := len(c.Cells) - 1; i >= 0; i-- {
+		cell := c.Cells[i]
+		lines := strings.Split(cell.Input, "\n")
+		containedLine, containedLen, containingLine := 0, 0, 0
+		for j, line := range lines {
+			normalized := stripCodeSpace(line)
+			if !hasCodeWord(normalized) {
+				continue
+			}
+			switch {
+			case normalized == target:
+				return cell.Num, j + 1, strings.TrimSpace(line)
+			case strings.Contains(target, normalized) && len(normalized) > containedLen:
+				containedLine, containedLen = j+1, len(normalized)
+			case strings.Contains(normalized, target) && containingLine == 0:
+				containingLine = j + 1
+			}
+		}
+		for _, n := range []int{containedLine, containingLine} {
+			if n > 0 {
+				return cell.Num, n, strings.TrimSpace(lines[n-1])
+			}
+		}
+	}
+	return 0, 0, ""
+}
+
+// 是否包含字母或数字，只有括号等符号的行无法确定位置
+func hasCodeWord(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) != -1
+}
+
+// 去掉代码中的空白字符，用于比较格式化前后的代码
+func stripCodeSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePanic(t *testing.T) {
+	errText := `panic: runtime error: index out of range [5] with length 2
+
+goroutine 1 [running]:
+main.at(...)
+	/tmp/.wgo/1/main.go:4
+main.main()
+	/tmp/.wgo/1/main.go:9 +0xa7
+exit status 2`
+	message, frames, ok := parsePanic(errText)
+	if !ok {
+		t.Fatal("应解析为 panic")
+	}
+	if message != "panic: runtime error: index out of range [5] with length 2" {
+		t.Fatalf("消息不符合预期: %q", message)
+	}
+	if len(frames) != 2 || frames[0].Func != "main.at" || frames[0].Line != 4 || frames[1].Func != "main.main" || frames[1].Line != 9 {
+		t.Fatalf("调用栈不符合预期: %+v", frames)
+	}
+	if _, _, ok := parsePanic("exit status 1"); ok {
+		t.Fatal("不是 panic 的输出不应解析")
+	}
+}
+
+// panic 的调用栈对应到输入编号和输入中的行号
+func TestInputAndRunPanicTraceback(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	for _, input := range []string{"xs := []int{1, 2}", "func at(xs []int, i int) int {\n\treturn xs[i]\n}"} {
+		if _, err := c.InputAndRun(input); err != nil {
+			t.Fatalf("%q 运行失败: %v", input, err)
+		}
+	}
+	_, err := c.InputAndRun("at(xs, 5)")
+	if err == nil {
+		t.Fatal("应返回 panic 错误")
+	}
+	msg := err.Error()
+	for _, expect := range []string{"index out of range [5] with length 2", "In[2]:2 at: return xs[i]", "In[3]:1 at(xs, 5)"} {
+		if !strings.Contains(msg, expect) {
+			t.Fatalf("错误中应包含 %q: %s", expect, msg)
+		}
+	}
+	if strings.Contains(msg, ".wgo") || strings.Contains(msg, "builtin_func.go") {
+		t.Fatalf("错误中不应包含生成的文件: %s", msg)
+	}
+}
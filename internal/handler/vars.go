@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wxnacy/go-tools"
+)
+
+var errSessionUnsupported = errors.New("会话模式下不支持该操作")
+
+// 保存的变量信息
+type VarInfo struct {
+	Name string // 变量名
+	Type string // 变量类型，来自序列化时保存的 .type 文件
+}
+
+// 获取保存的变量列表，顺序和 VarNames 一致
+// 类型信息读取失败时类型为空
+func (c *Coder) Vars() []VarInfo {
+	vars := make([]VarInfo, 0, len(c.VarNames))
+	for _, v := range c.VarNames {
+		typeName, _ := ReadVarType(v)
+		vars = append(vars, VarInfo{Name: v, Type: typeName})
+	}
+	return vars
+}
+
+// 删除保存的变量
+// 功能需求:
+// - 从 VarNames、FuncCodeMap 中删除，同时删除序列化的文件
+// - 变量被其他函数变量的闭包引用时不删除，返回错误
+// - 会话模式下变量保存在子进程中，不支持删除
+func (c *Coder) DeleteVar(name string) error {
+	if c.session != nil {
+		return errSessionUnsupported
+	}
+	idx := -1
+	for i, v := range c.VarNames {
+		if v == name {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return fmt.Errorf("没有找到变量 %s", name)
+	}
+
+	candidates := map[string]struct{}{name: {}}
+	var refs []string
+	for _, v := range c.VarNames {
+		if v == name {
+			continue
+		}
+		if funcCode, ok := c.lookupFuncCode(v); ok && len(funcSourceFreeVars(funcCode, candidates)) > 0 {
+			refs = append(refs, v)
+		}
+	}
+	if len(refs) > 0 {
+		return fmt.Errorf("变量 %s 被函数 %s 引用，请先删除", name, strings.Join(refs, ", "))
+	}
+
+	c.VarNames = append(c.VarNames[:idx:idx], c.VarNames[idx+1:]...)
+	delete(c.FuncCodeMap, name)
+	path := filepath.Join(GetTempDir(), VAR_PREFIX+name)
+	for _, p := range []string{path, path + ".type"} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除变量文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// 重置会话
+// 功能需求:
+// - 清空变量、包级声明、导入和输入记录，删除序列化的变量、输出结果文件和生成的 main 文件
+// - 会话模式下重新启动会话子进程
+func (c *Coder) Reset() error {
+	c.VarNames = nil
+	c.FuncCodeMap = nil
+	c.DeclNames = nil
+	c.DeclCodeMap = nil
+	c.Imports = nil
+	c.Cells = nil
+	c.pending = nil
+	c.sessionRuns = 0
+
+	entries, err := os.ReadDir(GetTempDir())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("读取临时目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), VAR_PREFIX) || strings.HasPrefix(entry.Name(), OUT_PREFIX) {
+			if err := os.Remove(filepath.Join(GetTempDir(), entry.Name())); err != nil {
+				return fmt.Errorf("删除变量文件失败: %w", err)
+			}
+		}
+	}
+	if err := os.Remove(GetMainFile()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除 main 文件失败: %w", err)
+	}
+
+	if c.session != nil {
+		if err := c.CloseSession(); err != nil {
+			logger.Errorf("关闭会话进程失败: %v", err)
+		}
+		return c.StartSession()
+	}
+	return nil
+}
+
+// 读取最近一次生成的 main 文件内容
+func (c *Coder) MainCode() (string, error) {
+	if c.session != nil {
+		return "", errSessionUnsupported
+	}
+	if !tools.FileExists(GetMainFile()) {
+		return "", errors.New("还没有生成代码")
+	}
+	return ReadCode(GetMainFile())
+}
+
+// 查看会话中名称对应的内容，用于 Jupyter 内核的 inspect 等
+// 功能需求:
+// - 变量返回变量名和类型，函数变量同时返回函数代码
+// - 包级声明返回声明的代码，类型同时返回它的方法
+// - 导入的包返回导入语句，输出结果 _n 返回对应的输入和输出
+// - 没有找到时返回 false
+func (c *Coder) Inspect(name string) (string, bool) {
+	for _, v := range c.Vars() {
+		if v.Name != name {
+			continue
+		}
+		text := fmt.Sprintf("%s %s", v.Name, v.Type)
+		if funcCode, ok := c.lookupFuncCode(name); ok {
+			text += "\n" + funcCode
+		}
+		return text, true
+	}
+	var codes []string
+	for _, declName := range c.DeclNames {
+		if declName == name || strings.HasPrefix(declName, name+".") {
+			codes = append(codes, c.DeclCodeMap[declName])
+		}
+	}
+	if len(codes) > 0 {
+		return strings.Join(codes, "\n\n"), true
+	}
+	for _, imp := range c.Imports {
+		if imp.localName() == name {
+			return "import " + imp.String(), true
+		}
+	}
+	if matches := outNamePattern.FindStringSubmatch(name); matches != nil {
+		var num int
+		fmt.Sscan(matches[1], &num)
+		if c.hasOut(num) {
+			cell := c.Cells[num-1]
+			return fmt.Sprintf("In[%d]: %s\nOut[%d]: %s", num, cell.Input, num, cell.Output), true
+		}
+	}
+	return "", false
+}
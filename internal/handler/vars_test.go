@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoderVarsAndDeleteVar(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	for _, input := range []string{
+		"a := 1",
+		`name := "wgo"`,
+		"add := func(n int) int { return a + n }",
+	} {
+		if _, err := c.InputAndRun(input); err != nil {
+			t.Fatalf("运行 %s 返回错误: %v", input, err)
+		}
+	}
+
+	expect := []VarInfo{
+		{Name: "a", Type: "int"},
+		{Name: "name", Type: "string"},
+		{Name: "add", Type: "func(int) int"},
+	}
+	if vars := c.Vars(); !reflect.DeepEqual(vars, expect) {
+		t.Fatalf("变量列表不符合预期: %v", vars)
+	}
+
+	if err := c.DeleteVar("a"); err == nil || !strings.Contains(err.Error(), "add") {
+		t.Fatalf("被函数引用的变量不应删除: %v", err)
+	}
+	if err := c.DeleteVar("missing"); err == nil {
+		t.Fatal("删除不存在的变量应返回错误")
+	}
+	if err := c.DeleteVar("name"); err != nil {
+		t.Fatalf("删除变量返回错误: %v", err)
+	}
+	if !reflect.DeepEqual(c.VarNames, []string{"a", "add"}) {
+		t.Fatalf("删除后变量列表不符合预期: %v", c.VarNames)
+	}
+	if _, err := os.Stat(filepath.Join(GetTempDir(), VAR_PREFIX+"name.type")); !os.IsNotExist(err) {
+		t.Fatalf("变量文件应被删除: %v", err)
+	}
+	if out, err := c.InputAndRun("add(1)"); err != nil || out != "2" {
+		t.Fatalf("删除变量后运行结果不符合预期: %q %v", out, err)
+	}
+}
+
+func TestCoderReset(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	for _, input := range []string{
+		`import str "strings"`,
+		"type User struct{ Name string }",
+		"a := 1",
+	} {
+		if _, err := c.InputAndRun(input); err != nil {
+			t.Fatalf("运行 %s 返回错误: %v", input, err)
+		}
+	}
+	code, err := c.MainCode()
+	if err != nil || !strings.Contains(code, "type User struct") {
+		t.Fatalf("读取 main 文件不符合预期: %q %v", code, err)
+	}
+
+	if err := c.Reset(); err != nil {
+		t.Fatalf("Reset 返回错误: %v", err)
+	}
+	if len(c.VarNames) != 0 || len(c.DeclNames) != 0 || len(c.Imports) != 0 {
+		t.Fatalf("Reset 后状态没有清空: %+v", c)
+	}
+	if _, err := c.MainCode(); err == nil {
+		t.Fatal("Reset 后 main 文件应被删除")
+	}
+	if _, err := os.Stat(filepath.Join(GetTempDir(), VAR_PREFIX+"a")); !os.IsNotExist(err) {
+		t.Fatalf("Reset 后变量文件应被删除: %v", err)
+	}
+	if out, err := c.InputAndRun("a := 2; a"); err != nil || out != "2" {
+		t.Fatalf("Reset 后运行结果不符合预期: %q %v", out, err)
+	}
+}
+
+// 查看变量、声明、导入和输出结果
+func TestCoderInspect(t *testing.T) {
+	prepareTestWorkspace(t)
+	c := &Coder{}
+	for _, input := range []string{
+		`import str "strings"`,
+		"type User struct{ Name string }",
+		`func (u User) Greet() string { return "hi " + u.Name }`,
+		`u := User{Name: "wgo"}`,
+		"u.Greet()",
+	} {
+		if _, err := c.InputAndRun(input); err != nil {
+			t.Fatalf("运行 %s 返回错误: %v", input, err)
+		}
+	}
+	cases := map[string]string{
+		"u":    "u User",
+		"User": "type User struct{ Name string }\n\nfunc (u User) Greet() string { return \"hi \" + u.Name }",
+		"str":  `import str "strings"`,
+		"_5":   "In[5]: u.Greet()\nOut[5]: hi wgo",
+	}
+	for name, expect := range cases {
+		if got, ok := c.Inspect(name); !ok || got != expect {
+			t.Fatalf("%s 的内容不符合预期: %q %v", name, got, ok)
+		}
+	}
+	if _, ok := c.Inspect("missing"); ok {
+		t.Fatal("不存在的名称应返回 false")
+	}
+}
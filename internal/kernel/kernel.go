@@ -0,0 +1,511 @@
+package kernel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/wxnacy/wgo/internal/handler"
+	log "github.com/wxnacy/wgo/internal/logger"
+)
+
+const SIGNATURE_SCHEME = "hmac-sha256" // 支持的签名算法
+
+var logger = log.GetLogger()
+
+// Jupyter 启动内核时传入的连接文件
+type ConnectionInfo struct {
+	Transport       string `json:"transport"` // tcp 或者 ipc
+	IP              string `json:"ip"`
+	ShellPort       int    `json:"shell_port"`
+	ControlPort     int    `json:"control_port"`
+	StdinPort       int    `json:"stdin_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	HBPort          int    `json:"hb_port"`
+	Key             string `json:"key"`              // 消息签名的密钥，为空时不签名
+	SignatureScheme string `json:"signature_scheme"` // 签名算法，只支持 hmac-sha256
+	KernelName      string `json:"kernel_name,omitempty"`
+}
+
+// 读取连接文件
+func ReadConnectionFile(path string) (ConnectionInfo, error) {
+	var conn ConnectionInfo
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return conn, fmt.Errorf("读取连接文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &conn); err != nil {
+		return conn, fmt.Errorf("解析连接文件 %s 失败: %w", path, err)
+	}
+	if conn.Transport == "" {
+		conn.Transport = "tcp"
+	}
+	if conn.Key != "" && conn.SignatureScheme != SIGNATURE_SCHEME {
+		return conn, fmt.Errorf("不支持的签名算法 %s，只支持 %s", conn.SignatureScheme, SIGNATURE_SCHEME)
+	}
+	return conn, nil
+}
+
+// 端口对应的地址，ipc 使用 ip-端口 作为文件路径
+func (c ConnectionInfo) endpoint(port int) string {
+	if c.Transport == "ipc" {
+		return fmt.Sprintf("ipc://%s-%d", c.IP, port)
+	}
+	return fmt.Sprintf("%s://%s:%d", c.Transport, c.IP, port)
+}
+
+// 内核的选项
+type Options struct {
+	Coder   *handler.Coder // 运行代码的 Coder，为空时使用 GetCoder
+	Version string         // wgo 的版本，在 kernel_info_reply 中返回
+	// 补全代码，cursor 为 input 中的字节偏移量，返回补全项的文本，为空时不补全
+	Complete func(input string, cursor int) []string
+	// 运行元命令，input 不是元命令时返回 false，为空时不支持元命令
+	Meta func(input string) (string, bool)
+}
+
+// Jupyter 内核
+// 功能需求:
+//   - 通过 ZeroMQ 实现 Jupyter 消息协议，shell、control 使用 ROUTER，iopub 使用 PUB，心跳使用 REP
+//   - 不支持 stdin 通道，不监听 stdin 端口，运行的代码读取 stdin 时得到 EOF
+//   - shell 中的请求按顺序处理，control 中的请求单独处理，运行代码时可以通过 interrupt_request 中断
+//   - execute_request 通过 Coder.InputAndRunContext 运行，输出按行作为 stream 消息实时发送
+//   - complete_request 通过 Options.Complete 补全，inspect_request 通过 Coder.Inspect 查看会话中的变量、声明和导入
+//   - shutdown_request 结束 Run，restart 为 true 时中断正在运行的代码，等待 shell 中的请求处理完成后重置会话，继续运行
+type Kernel struct {
+	conn    ConnectionInfo
+	opts    Options
+	coder   *handler.Coder
+	signer  signer
+	session string // 内核的会话 ID
+
+	shell, control, iopub, hb zmq4.Socket
+	iopubMu                   sync.Mutex
+
+	coderMu    sync.Mutex // 处理 shell 中的请求以及重置会话时持有，保证同时只有一个 goroutine 使用 coder
+	runMu      sync.Mutex
+	cancel     context.CancelFunc // 正在运行的代码的取消函数
+	restarting bool               // 正在重置会话，这期间开始运行的代码直接中断
+
+	shutdown chan struct{}
+	once     sync.Once
+}
+
+// 创建内核
+func New(conn ConnectionInfo, opts Options) *Kernel {
+	coder := opts.Coder
+	if coder == nil {
+		coder = handler.GetCoder()
+	}
+	return &Kernel{
+		conn:     conn,
+		opts:     opts,
+		coder:    coder,
+		signer:   signer{key: []byte(conn.Key)},
+		session:  newID(),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// 绑定端口并处理请求，直到收到 shutdown_request 或者 ctx 结束
+func (k *Kernel) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	k.shell = zmq4.NewRouter(ctx)
+	k.control = zmq4.NewRouter(ctx)
+	k.iopub = zmq4.NewPub(ctx)
+	k.hb = zmq4.NewRep(ctx)
+	sockets := []struct {
+		name   string
+		socket zmq4.Socket
+		port   int
+	}{
+		{"shell", k.shell, k.conn.ShellPort},
+		{"control", k.control, k.conn.ControlPort},
+		{"iopub", k.iopub, k.conn.IOPubPort},
+		{"hb", k.hb, k.conn.HBPort},
+	}
+	defer func() {
+		for _, s := range sockets {
+			s.socket.Close()
+		}
+	}()
+	for _, s := range sockets {
+		if err := s.socket.Listen(k.conn.endpoint(s.port)); err != nil {
+			return fmt.Errorf("监听 %s 端口 %d 失败: %w", s.name, s.port, err)
+		}
+	}
+	logger.Infof("Jupyter 内核已启动，shell 端口 %d", k.conn.ShellPort)
+	k.publish(nil, "status", map[string]string{"execution_state": "starting"})
+
+	go k.heartbeat()
+	go k.serve(ctx, k.control)
+	go k.serve(ctx, k.shell)
+
+	select {
+	case <-ctx.Done():
+	case <-k.shutdown:
+	}
+	k.Interrupt()
+	logger.Infoln("Jupyter 内核已关闭")
+	return nil
+}
+
+// 中断正在运行的代码
+func (k *Kernel) Interrupt() {
+	k.runMu.Lock()
+	defer k.runMu.Unlock()
+	if k.cancel != nil {
+		k.cancel()
+	}
+}
+
+// 心跳，原样返回收到的消息
+func (k *Kernel) heartbeat() {
+	for {
+		msg, err := k.hb.Recv()
+		if err != nil {
+			return
+		}
+		if err := k.hb.Send(msg); err != nil {
+			return
+		}
+	}
+}
+
+// 按顺序处理 socket 中的请求
+// shell 中的请求会使用 coder，处理时持有 coderMu
+func (k *Kernel) serve(ctx context.Context, socket zmq4.Socket) {
+	for {
+		raw, err := socket.Recv()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Errorf("接收消息失败: %v", err)
+			}
+			return
+		}
+		msg, err := k.signer.decode(raw.Frames)
+		if err != nil {
+			logger.Errorf("解析消息失败: %v", err)
+			continue
+		}
+		logger.Debugf("收到消息 %s", msg.Header.MsgType)
+		k.publish(msg, "status", map[string]string{"execution_state": "busy"})
+		if socket == k.shell {
+			k.coderMu.Lock()
+			k.handle(ctx, socket, msg)
+			k.coderMu.Unlock()
+		} else {
+			k.handle(ctx, socket, msg)
+		}
+		k.publish(msg, "status", map[string]string{"execution_state": "idle"})
+	}
+}
+
+func (k *Kernel) handle(ctx context.Context, socket zmq4.Socket, msg *Message) {
+	replyType := strings.TrimSuffix(msg.Header.MsgType, "_request") + "_reply"
+
+	switch msg.Header.MsgType {
+	case "kernel_info_request":
+		k.reply(socket, msg, replyType, k.kernelInfo())
+	case "execute_request":
+		k.reply(socket, msg, replyType, k.execute(ctx, msg))
+	case "complete_request":
+		var req struct {
+			Code      string `json:"code"`
+			CursorPos int    `json:"cursor_pos"`
+		}
+		json.Unmarshal(msg.Content, &req)
+		k.reply(socket, msg, replyType, k.complete(req.Code, req.CursorPos))
+	case "inspect_request":
+		var req struct {
+			Code      string `json:"code"`
+			CursorPos int    `json:"cursor_pos"`
+		}
+		json.Unmarshal(msg.Content, &req)
+		k.reply(socket, msg, replyType, k.inspect(req.Code, req.CursorPos))
+	case "is_complete_request":
+		var req struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(msg.Content, &req)
+		status := "incomplete"
+		if handler.IsCompleteInput(req.Code) {
+			status = "complete"
+		}
+		k.reply(socket, msg, replyType, map[string]string{"status": status, "indent": ""})
+	case "history_request":
+		history := make([][]any, 0, len(k.coder.Cells))
+		for _, cell := range k.coder.Cells {
+			history = append(history, []any{0, cell.Num, cell.Input})
+		}
+		k.reply(socket, msg, replyType, map[string]any{"status": "ok", "history": history})
+	case "comm_info_request":
+		k.reply(socket, msg, replyType, map[string]any{"status": "ok", "comms": map[string]any{}})
+	case "interrupt_request":
+		k.Interrupt()
+		k.reply(socket, msg, replyType, map[string]string{"status": "ok"})
+	case "shutdown_request":
+		var req struct {
+			Restart bool `json:"restart"`
+		}
+		json.Unmarshal(msg.Content, &req)
+		if req.Restart {
+			k.restart()
+			k.reply(socket, msg, replyType, map[string]any{"status": "ok", "restart": true})
+			return
+		}
+		k.reply(socket, msg, replyType, map[string]any{"status": "ok", "restart": false})
+		k.once.Do(func() { close(k.shutdown) })
+	default:
+		logger.Infof("不支持的消息类型 %s", msg.Header.MsgType)
+	}
+}
+
+// 重置会话
+// 先中断正在运行的代码，再等待 shell 中的请求处理完成，避免和运行中的代码同时使用 coder
+func (k *Kernel) restart() {
+	k.runMu.Lock()
+	k.restarting = true
+	if k.cancel != nil {
+		k.cancel()
+	}
+	k.runMu.Unlock()
+
+	k.coderMu.Lock()
+	defer k.coderMu.Unlock()
+	if err := k.coder.Reset(); err != nil {
+		logger.Errorf("重置会话失败: %v", err)
+	}
+	k.runMu.Lock()
+	k.restarting = false
+	k.runMu.Unlock()
+}
+
+func (k *Kernel) kernelInfo() map[string]any {
+	return map[string]any{
+		"status":                 "ok",
+		"protocol_version":       PROTOCOL_VERSION,
+		"implementation":         "wgo",
+		"implementation_version": k.opts.Version,
+		"language_info": map[string]string{
+			"name":            "go",
+			"version":         strings.TrimPrefix(runtime.Version(), "go"),
+			"mimetype":        "text/x-go",
+			"file_extension":  ".go",
+			"pygments_lexer":  "go",
+			"codemirror_mode": "go",
+		},
+		"banner":     "wgo - 类 IPython 的 Golang 交互运行工具",
+		"help_links": []any{},
+	}
+}
+
+// 运行代码
+// 功能需求:
+//   - 执行编号和输入编号一致，之后的输入可以通过 Out[n] 引用，会话模式下按执行次数计数
+//   - 以 : 开头的输入作为元命令运行
+//   - 输出按行作为 stream 消息发送，没有实时输出时运行结束后发送全部输出
+//   - 运行失败时发送 error 消息，中断时 ename 为 Interrupted
+//   - silent 为 true 时不发送输出
+func (k *Kernel) execute(ctx context.Context, msg *Message) map[string]any {
+	var req struct {
+		Code   string `json:"code"`
+		Silent bool   `json:"silent"`
+	}
+	json.Unmarshal(msg.Content, &req)
+	count := k.coder.NextCellNum()
+	if !req.Silent {
+		k.publish(msg, "execute_input", map[string]any{"code": req.Code, "execution_count": count})
+	}
+
+	var streamed atomic.Bool
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	runCtx = handler.WithOutputFunc(runCtx, func(line handler.OutputLine) {
+		if req.Silent {
+			return
+		}
+		streamed.Store(true)
+		k.stream(msg, line.Stderr, line.Text+"\n")
+	})
+	k.runMu.Lock()
+	k.cancel = cancel
+	if k.restarting {
+		cancel()
+	}
+	k.runMu.Unlock()
+	defer func() {
+		k.runMu.Lock()
+		k.cancel = nil
+		k.runMu.Unlock()
+	}()
+
+	var out string
+	var err error
+	if meta, ok := k.runMeta(req.Code); ok {
+		out = meta
+	} else {
+		out, err = k.coder.InputAndRunContext(runCtx, req.Code)
+	}
+	if err != nil {
+		ename := "RunError"
+		switch {
+		case errors.Is(err, handler.ErrRunInterrupted):
+			ename = "Interrupted"
+		case errors.Is(err, handler.ErrRunTimeout):
+			ename = "Timeout"
+		}
+		reply := map[string]any{
+			"status":          "error",
+			"execution_count": count,
+			"ename":           ename,
+			"evalue":          err.Error(),
+			"traceback":       strings.Split(err.Error(), "\n"),
+		}
+		if !req.Silent {
+			k.publish(msg, "error", reply)
+		}
+		return reply
+	}
+	if out != "" && !streamed.Load() && !req.Silent {
+		k.stream(msg, false, strings.TrimSuffix(out, "\n")+"\n")
+	}
+	return map[string]any{
+		"status":           "ok",
+		"execution_count":  count,
+		"user_expressions": map[string]any{},
+		"payload":          []any{},
+	}
+}
+
+func (k *Kernel) runMeta(input string) (string, bool) {
+	if k.opts.Meta == nil {
+		return "", false
+	}
+	return k.opts.Meta(input)
+}
+
+// 补全代码，Jupyter 中的光标位置按照 unicode 字符计算
+func (k *Kernel) complete(code string, cursorPos int) map[string]any {
+	cursor := byteOffset(code, cursorPos)
+	matches := []string{}
+	if k.opts.Complete != nil {
+		matches = append(matches, k.opts.Complete(code, cursor)...)
+	}
+	// 和终端中一样，替换光标前的单词
+	start := strings.LastIndexAny(code[:cursor], " .()[]{}<>\t\n") + 1
+	return map[string]any{
+		"status":       "ok",
+		"matches":      matches,
+		"cursor_start": utf8.RuneCountInString(code[:start]),
+		"cursor_end":   cursorPos,
+		"metadata":     map[string]any{},
+	}
+}
+
+// 查看光标所在的名称
+func (k *Kernel) inspect(code string, cursorPos int) map[string]any {
+	name := identAt(code, byteOffset(code, cursorPos))
+	text, found := "", false
+	if name != "" {
+		text, found = k.coder.Inspect(name)
+	}
+	data := map[string]string{}
+	if found {
+		data["text/plain"] = text
+	}
+	return map[string]any{"status": "ok", "found": found, "data": data, "metadata": map[string]any{}}
+}
+
+// 光标所在或者光标前的标识符
+func identAt(code string, cursor int) string {
+	isIdent := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	start := cursor
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(code[:start])
+		if !isIdent(r) {
+			break
+		}
+		start -= size
+	}
+	end := cursor
+	for end < len(code) {
+		r, size := utf8.DecodeRuneInString(code[end:])
+		if !isIdent(r) {
+			break
+		}
+		end += size
+	}
+	return code[start:end]
+}
+
+// unicode 字符的位置转换为字节偏移量
+func byteOffset(code string, runePos int) int {
+	if runePos <= 0 {
+		return 0
+	}
+	n := 0
+	for i := range code {
+		if n == runePos {
+			return i
+		}
+		n++
+	}
+	return len(code)
+}
+
+// 发送输出
+func (k *Kernel) stream(parent *Message, stderr bool, text string) {
+	name := "stdout"
+	if stderr {
+		name = "stderr"
+	}
+	k.publish(parent, "stream", map[string]string{"name": name, "text": text})
+}
+
+// 在 iopub 中广播消息，主题为消息类型
+func (k *Kernel) publish(parent *Message, msgType string, content any) {
+	msg, err := newMessage(msgType, parent, k.session, content)
+	if err != nil {
+		logger.Errorf("创建消息失败: %v", err)
+		return
+	}
+	msg.Identities = [][]byte{[]byte(msgType)}
+	k.iopubMu.Lock()
+	defer k.iopubMu.Unlock()
+	k.send(k.iopub, msg)
+}
+
+// 回复请求
+func (k *Kernel) reply(socket zmq4.Socket, parent *Message, msgType string, content any) {
+	msg, err := newMessage(msgType, parent, k.session, content)
+	if err != nil {
+		logger.Errorf("创建消息失败: %v", err)
+		return
+	}
+	k.send(socket, msg)
+}
+
+func (k *Kernel) send(socket zmq4.Socket, msg *Message) {
+	frames, err := k.signer.encode(msg)
+	if err != nil {
+		logger.Errorf("编码消息失败: %v", err)
+		return
+	}
+	if err := socket.SendMulti(zmq4.NewMsgFrom(frames...)); err != nil {
+		logger.Errorf("发送消息 %s 失败: %v", msg.Header.MsgType, err)
+	}
+}
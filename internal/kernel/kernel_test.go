@@ -0,0 +1,334 @@
+package kernel
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/wxnacy/wgo/internal/handler"
+)
+
+// 模拟 Jupyter 前端
+type fakeFrontend struct {
+	t       *testing.T
+	signer  signer
+	shell   zmq4.Socket
+	control zmq4.Socket
+	iopub   chan *Message
+}
+
+// 在临时目录中初始化工作目录，测试结束后删除，不在源码目录中留下文件
+func prepareTestWorkspace(t *testing.T) {
+	t.Helper()
+	req := handler.GetRequest()
+	saved := *req
+	workspace := t.TempDir()
+	req.Workspace = workspace
+	req.MainDir = filepath.Join(workspace, ".wgo", req.ID)
+	req.MainFile = filepath.Join(req.MainDir, "main.go")
+	handler.Init()
+	t.Cleanup(func() {
+		handler.Destory()
+		*req = saved
+	})
+}
+
+// 获取空闲的端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// 启动内核并连接
+func startKernel(t *testing.T, opts Options) (*fakeFrontend, <-chan error) {
+	t.Helper()
+	conn := ConnectionInfo{
+		Transport:       "tcp",
+		IP:              "127.0.0.1",
+		ShellPort:       freePort(t),
+		ControlPort:     freePort(t),
+		StdinPort:       freePort(t),
+		IOPubPort:       freePort(t),
+		HBPort:          freePort(t),
+		Key:             "secret",
+		SignatureScheme: SIGNATURE_SCHEME,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	done := make(chan error, 1)
+	go func() { done <- New(conn, opts).Run(ctx) }()
+
+	f := &fakeFrontend{
+		t:       t,
+		signer:  signer{key: []byte(conn.Key)},
+		shell:   zmq4.NewDealer(ctx),
+		control: zmq4.NewDealer(ctx),
+		iopub:   make(chan *Message, 100),
+	}
+	sub := zmq4.NewSub(ctx)
+	hb := zmq4.NewReq(ctx)
+	t.Cleanup(func() {
+		for _, s := range []zmq4.Socket{f.shell, f.control, sub, hb} {
+			s.Close()
+		}
+	})
+	for _, dial := range []struct {
+		socket zmq4.Socket
+		port   int
+	}{
+		{f.shell, conn.ShellPort},
+		{f.control, conn.ControlPort},
+		{sub, conn.IOPubPort},
+		{hb, conn.HBPort},
+	} {
+		var err error
+		// 内核在后台监听端口，连接失败时重试
+		for i := 0; i < 50; i++ {
+			if err = dial.socket.Dial(conn.endpoint(dial.port)); err == nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("连接内核失败: %v", err)
+		}
+	}
+	if err := sub.SetOption(zmq4.OptionSubscribe, ""); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			raw, err := sub.Recv()
+			if err != nil {
+				return
+			}
+			if msg, err := f.signer.decode(raw.Frames); err == nil {
+				f.iopub <- msg
+			}
+		}
+	}()
+
+	if err := hb.Send(zmq4.NewMsgString("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := hb.Recv(); err != nil || string(msg.Bytes()) != "ping" {
+		t.Fatalf("心跳没有原样返回: %q %v", msg.Bytes(), err)
+	}
+
+	// 订阅生效之前的广播会丢失，直到收到 kernel_info_request 的状态广播
+	for i := 0; ; i++ {
+		if i == 50 {
+			t.Fatal("没有收到 iopub 广播")
+		}
+		f.request(f.shell, "kernel_info_request", map[string]any{})
+		select {
+		case <-f.iopub:
+		case <-time.After(100 * time.Millisecond):
+			continue
+		}
+		break
+	}
+	f.drain()
+	return f, done
+}
+
+// 发送请求并等待回复
+func (f *fakeFrontend) request(socket zmq4.Socket, msgType string, content any) (*Message, map[string]any) {
+	f.t.Helper()
+	msg := f.send(socket, msgType, content)
+	return msg, f.recv(socket, msg)
+}
+
+// 发送请求，不等待回复
+func (f *fakeFrontend) send(socket zmq4.Socket, msgType string, content any) *Message {
+	f.t.Helper()
+	msg, err := newMessage(msgType, nil, "frontend", content)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	frames, err := f.signer.encode(msg)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if err := socket.SendMulti(zmq4.NewMsgFrom(frames...)); err != nil {
+		f.t.Fatal(err)
+	}
+	return msg
+}
+
+// 接收 msg 的回复
+func (f *fakeFrontend) recv(socket zmq4.Socket, msg *Message) map[string]any {
+	f.t.Helper()
+	msgType := msg.Header.MsgType
+	raw, err := socket.Recv()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	reply, err := f.signer.decode(raw.Frames)
+	if err != nil {
+		f.t.Fatalf("解析回复失败: %v", err)
+	}
+	if reply.Header.MsgType != strings.TrimSuffix(msgType, "_request")+"_reply" || reply.ParentHeader == nil || reply.ParentHeader.MsgID != msg.Header.MsgID {
+		f.t.Fatalf("回复不符合预期: %+v %+v", reply.Header, reply.ParentHeader)
+	}
+	var replyContent map[string]any
+	json.Unmarshal(reply.Content, &replyContent)
+	return replyContent
+}
+
+// 收集请求的 iopub 广播，直到状态变为 idle
+func (f *fakeFrontend) collect(parent *Message) []*Message {
+	f.t.Helper()
+	var msgs []*Message
+	for {
+		select {
+		case msg := <-f.iopub:
+			if msg.ParentHeader == nil || msg.ParentHeader.MsgID != parent.Header.MsgID {
+				continue
+			}
+			if msg.Header.MsgType == "status" && strings.Contains(string(msg.Content), "idle") {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		case <-time.After(30 * time.Second):
+			f.t.Fatalf("没有收到 %s 的 idle 状态", parent.Header.MsgType)
+		}
+	}
+}
+
+// 丢弃已经收到的广播
+func (f *fakeFrontend) drain() {
+	for {
+		select {
+		case <-f.iopub:
+		case <-time.After(200 * time.Millisecond):
+			return
+		}
+	}
+}
+
+// 执行代码，返回回复和输出
+func (f *fakeFrontend) execute(code string) (map[string]any, string, []*Message) {
+	f.t.Helper()
+	msg, reply := f.request(f.shell, "execute_request", map[string]any{"code": code, "silent": false})
+	msgs := f.collect(msg)
+	var out strings.Builder
+	for _, m := range msgs {
+		if m.Header.MsgType == "stream" {
+			var content map[string]string
+			json.Unmarshal(m.Content, &content)
+			out.WriteString(content["text"])
+		}
+	}
+	return reply, out.String(), msgs
+}
+
+func TestKernel(t *testing.T) {
+	prepareTestWorkspace(t)
+	f, done := startKernel(t, Options{
+		Coder:   &handler.Coder{},
+		Version: "test",
+		Complete: func(input string, cursor int) []string {
+			if input[:cursor] == "fmt.Pri" {
+				return []string{"Println", "Printf"}
+			}
+			return nil
+		},
+	})
+
+	_, info := f.request(f.shell, "kernel_info_request", map[string]any{})
+	if info["protocol_version"] != PROTOCOL_VERSION || info["language_info"].(map[string]any)["name"] != "go" {
+		t.Fatalf("kernel_info_reply 不符合预期: %v", info)
+	}
+
+	reply, out, _ := f.execute("x := 21")
+	if reply["status"] != "ok" || reply["execution_count"] != float64(1) || out != "" {
+		t.Fatalf("execute_reply 不符合预期: %v %q", reply, out)
+	}
+	reply, out, msgs := f.execute("x * 2")
+	if reply["status"] != "ok" || reply["execution_count"] != float64(2) || out != "42\n" {
+		t.Fatalf("运行结果不符合预期: %v %q", reply, out)
+	}
+	if msgs[0].Header.MsgType != "status" || msgs[1].Header.MsgType != "execute_input" {
+		t.Fatalf("应先广播 busy 状态和 execute_input: %s %s", msgs[0].Header.MsgType, msgs[1].Header.MsgType)
+	}
+
+	reply, _, msgs = f.execute("undefinedVar + 1")
+	if reply["status"] != "error" || !strings.Contains(reply["evalue"].(string), "undefinedVar") {
+		t.Fatalf("运行失败时应返回错误: %v", reply)
+	}
+	if last := msgs[len(msgs)-1]; last.Header.MsgType != "error" {
+		t.Fatalf("运行失败时应广播 error: %s", last.Header.MsgType)
+	}
+
+	_, inspect := f.request(f.shell, "inspect_request", map[string]any{"code": "x + 1", "cursor_pos": 1})
+	if inspect["found"] != true || !strings.Contains(inspect["data"].(map[string]any)["text/plain"].(string), "x int") {
+		t.Fatalf("inspect_reply 不符合预期: %v", inspect)
+	}
+
+	_, complete := f.request(f.shell, "complete_request", map[string]any{"code": "fmt.Pri", "cursor_pos": 7})
+	if matches := complete["matches"].([]any); len(matches) != 2 || matches[0] != "Println" || complete["cursor_start"] != float64(4) || complete["cursor_end"] != float64(7) {
+		t.Fatalf("complete_reply 不符合预期: %v", complete)
+	}
+
+	_, isComplete := f.request(f.shell, "is_complete_request", map[string]any{"code": "for i := 0; i < 3; i++ {"})
+	if isComplete["status"] != "incomplete" {
+		t.Fatalf("is_complete_reply 不符合预期: %v", isComplete)
+	}
+
+	f.request(f.control, "shutdown_request", map[string]any{"restart": false})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("内核退出失败: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("shutdown_request 后内核没有退出")
+	}
+}
+
+// 运行中重置会话，先中断正在运行的代码，再清空会话
+func TestKernelRestartDuringExecute(t *testing.T) {
+	prepareTestWorkspace(t)
+	f, _ := startKernel(t, Options{Coder: &handler.Coder{}, Version: "test"})
+
+	if reply, _, _ := f.execute("x := 21"); reply["status"] != "ok" {
+		t.Fatalf("execute_reply 不符合预期: %v", reply)
+	}
+	msg := f.send(f.shell, "execute_request", map[string]any{"code": "time.Sleep(time.Hour)", "silent": false})
+	for started := false; !started; {
+		select {
+		case m := <-f.iopub:
+			started = m.ParentHeader != nil && m.ParentHeader.MsgID == msg.Header.MsgID && m.Header.MsgType == "execute_input"
+		case <-time.After(30 * time.Second):
+			t.Fatal("代码没有开始运行")
+		}
+	}
+
+	begin := time.Now()
+	if _, restart := f.request(f.control, "shutdown_request", map[string]any{"restart": true}); restart["restart"] != true {
+		t.Fatalf("shutdown_reply 不符合预期: %v", restart)
+	}
+	if cost := time.Since(begin); cost > 30*time.Second {
+		t.Fatalf("重置会话应中断正在运行的代码: %v", cost)
+	}
+	if reply := f.recv(f.shell, msg); reply["status"] != "error" || reply["ename"] != "Interrupted" {
+		t.Fatalf("运行中的代码应被中断: %v", reply)
+	}
+	f.drain()
+
+	reply, _, _ := f.execute("x")
+	if reply["status"] != "error" || reply["execution_count"] != float64(1) {
+		t.Fatalf("重置后变量和编号应被清空: %v", reply)
+	}
+}
@@ -0,0 +1,76 @@
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const KERNEL_NAME = "wgo" // 安装到 Jupyter 中的内核名称
+
+// Jupyter 内核描述文件 kernel.json
+type KernelSpec struct {
+	Argv          []string `json:"argv"`
+	DisplayName   string   `json:"display_name"`
+	Language      string   `json:"language"`
+	InterruptMode string   `json:"interrupt_mode"`
+}
+
+// 当前用户的 Jupyter 内核目录
+// 优先使用 JUPYTER_DATA_DIR，否则使用 Jupyter 在各个系统中的默认目录
+func DefaultKernelsDir() (string, error) {
+	if dir := os.Getenv("JUPYTER_DATA_DIR"); dir != "" {
+		return filepath.Join(dir, "kernels"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Jupyter", "kernels"), nil
+	case "windows":
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "jupyter", "kernels"), nil
+		}
+		return filepath.Join(home, "AppData", "Roaming", "jupyter", "kernels"), nil
+	default:
+		return filepath.Join(home, ".local", "share", "jupyter", "kernels"), nil
+	}
+}
+
+// 安装内核描述文件到 dir/wgo/kernel.json，dir 为空时使用 DefaultKernelsDir
+// Jupyter 启动内核时运行当前的 wgo 程序: wgo kernel <连接文件>
+// 返回内核描述文件所在的目录
+func InstallKernelSpec(dir string) (string, error) {
+	if dir == "" {
+		var err error
+		if dir, err = DefaultKernelsDir(); err != nil {
+			return "", err
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("获取 wgo 路径失败: %w", err)
+	}
+	spec := KernelSpec{
+		Argv:          []string{exe, "kernel", "{connection_file}"},
+		DisplayName:   "Go (wgo)",
+		Language:      "go",
+		InterruptMode: "message",
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	specDir := filepath.Join(dir, KERNEL_NAME)
+	if err := os.MkdirAll(specDir, 0o755); err != nil {
+		return "", fmt.Errorf("创建内核目录失败: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(specDir, "kernel.json"), append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("写入内核描述文件失败: %w", err)
+	}
+	return specDir, nil
+}
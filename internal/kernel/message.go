@@ -0,0 +1,158 @@
+package kernel
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	PROTOCOL_VERSION = "5.3"       // 实现的 Jupyter 消息协议版本
+	DELIMITER        = "<IDS|MSG>" // 路由标识和消息内容之间的分隔帧
+)
+
+var errInvalidSignature = errors.New("消息签名不正确")
+
+// 消息头
+type Header struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// Jupyter 消息
+// 在 ZeroMQ 中按照以下顺序作为多个帧发送
+//   - 路由标识，iopub 中为主题
+//   - DELIMITER
+//   - HMAC 签名，没有设置 key 时为空
+//   - header、parent_header、metadata、content 的 JSON
+//   - 附加的二进制数据
+type Message struct {
+	Identities   [][]byte
+	Header       Header
+	ParentHeader *Header // 回复的请求，为空时编码为 {}
+	Metadata     map[string]any
+	Content      json.RawMessage
+	Buffers      [][]byte
+}
+
+// 消息签名，key 为空时不签名
+type signer struct {
+	key []byte
+}
+
+func (s signer) sign(frames ...[]byte) []byte {
+	if len(s.key) == 0 {
+		return nil
+	}
+	mac := hmac.New(sha256.New, s.key)
+	for _, frame := range frames {
+		mac.Write(frame)
+	}
+	return []byte(hex.EncodeToString(mac.Sum(nil)))
+}
+
+// 解析收到的多个帧，签名不正确时返回错误
+func (s signer) decode(frames [][]byte) (*Message, error) {
+	idx := -1
+	for i, frame := range frames {
+		if string(frame) == DELIMITER {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 || len(frames) < idx+6 {
+		return nil, fmt.Errorf("消息格式不正确，共 %d 帧", len(frames))
+	}
+	signature, parts := frames[idx+1], frames[idx+2:idx+6]
+	if len(s.key) > 0 && !hmac.Equal(signature, s.sign(parts...)) {
+		return nil, errInvalidSignature
+	}
+
+	msg := &Message{Identities: frames[:idx], Content: json.RawMessage(parts[3]), Buffers: frames[idx+6:]}
+	if err := json.Unmarshal(parts[0], &msg.Header); err != nil {
+		return nil, fmt.Errorf("解析消息头失败: %w", err)
+	}
+	parent := &Header{}
+	if err := json.Unmarshal(parts[1], parent); err == nil && parent.MsgID != "" {
+		msg.ParentHeader = parent
+	}
+	if err := json.Unmarshal(parts[2], &msg.Metadata); err != nil {
+		return nil, fmt.Errorf("解析消息元数据失败: %w", err)
+	}
+	return msg, nil
+}
+
+// 编码为发送的多个帧
+func (s signer) encode(msg *Message) ([][]byte, error) {
+	header, err := json.Marshal(msg.Header)
+	if err != nil {
+		return nil, err
+	}
+	parent := []byte("{}")
+	if msg.ParentHeader != nil {
+		if parent, err = json.Marshal(msg.ParentHeader); err != nil {
+			return nil, err
+		}
+	}
+	metadata := []byte("{}")
+	if len(msg.Metadata) > 0 {
+		if metadata, err = json.Marshal(msg.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	content := []byte(msg.Content)
+	if len(bytes.TrimSpace(content)) == 0 {
+		content = []byte("{}")
+	}
+
+	frames := make([][]byte, 0, len(msg.Identities)+6+len(msg.Buffers))
+	frames = append(frames, msg.Identities...)
+	frames = append(frames, []byte(DELIMITER), s.sign(header, parent, metadata, content))
+	frames = append(frames, header, parent, metadata, content)
+	return append(frames, msg.Buffers...), nil
+}
+
+// 创建回复 parent 的消息，回复发送给 parent 的路由标识
+func newMessage(msgType string, parent *Message, session string, content any) (*Message, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("序列化消息内容失败: %w", err)
+	}
+	msg := &Message{
+		Header: Header{
+			MsgID:    newID(),
+			Session:  session,
+			Username: "wgo",
+			Date:     time.Now().UTC().Format(time.RFC3339Nano),
+			MsgType:  msgType,
+			Version:  PROTOCOL_VERSION,
+		},
+		Content: data,
+	}
+	if parent != nil {
+		header := parent.Header
+		msg.ParentHeader = &header
+		msg.Identities = parent.Identities
+		msg.Header.Username = parent.Header.Username
+	}
+	return msg, nil
+}
+
+// 生成 UUID 格式的随机 ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
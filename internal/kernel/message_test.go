@@ -0,0 +1,67 @@
+package kernel
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// 编码后的消息可以解析回来，签名不正确时返回错误
+func TestEncodeDecode(t *testing.T) {
+	s := signer{key: []byte("secret")}
+	parent := &Message{
+		Identities: [][]byte{[]byte("client")},
+		Header:     Header{MsgID: "1", MsgType: "execute_request", Username: "user"},
+	}
+	msg, err := newMessage("execute_reply", parent, "session", map[string]string{"status": "ok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := s.encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frames[0]) != "client" || string(frames[1]) != DELIMITER || len(frames[2]) != 64 {
+		t.Fatalf("消息帧不符合预期: %q", frames)
+	}
+
+	decoded, err := s.decode(frames)
+	if err != nil {
+		t.Fatalf("解析消息失败: %v", err)
+	}
+	if decoded.Header.MsgType != "execute_reply" || decoded.Header.Username != "user" || decoded.ParentHeader == nil || decoded.ParentHeader.MsgID != "1" {
+		t.Fatalf("消息头不符合预期: %+v %+v", decoded.Header, decoded.ParentHeader)
+	}
+	var content map[string]string
+	if err := json.Unmarshal(decoded.Content, &content); err != nil || content["status"] != "ok" {
+		t.Fatalf("消息内容不符合预期: %s", decoded.Content)
+	}
+
+	if _, err := (signer{key: []byte("other")}).decode(frames); !errors.Is(err, errInvalidSignature) {
+		t.Fatalf("签名不正确时应返回错误: %v", err)
+	}
+	if _, err := s.decode(frames[:4]); err == nil {
+		t.Fatal("帧数不足时应返回错误")
+	}
+	// 没有 key 时不签名也不校验
+	if frames, _ := (signer{}).encode(msg); len(frames[2]) != 0 {
+		t.Fatalf("没有 key 时签名应为空: %q", frames[2])
+	}
+}
+
+func TestIdentAt(t *testing.T) {
+	for _, tt := range []struct {
+		code   string
+		cursor int
+		expect string
+	}{
+		{"user.Name", 2, "user"},
+		{"user.Name", 4, "user"},
+		{"fmt.Println(名字)", 14, "名字"},
+		{"a + ", 4, ""},
+	} {
+		if got := identAt(tt.code, byteOffset(tt.code, tt.cursor)); got != tt.expect {
+			t.Fatalf("identAt(%q, %d) = %q，应为 %q", tt.code, tt.cursor, got, tt.expect)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/wxnacy/wgo/internal/handler"
+	log "github.com/wxnacy/wgo/internal/logger"
+	"github.com/wxnacy/wgo/pkg/rpc"
+)
+
+var logger = log.GetLogger()
+
+// 服务的选项
+type Options struct {
+	Coder *handler.Coder // 运行代码的 Coder，为空时使用 GetCoder
+	// 补全代码，cursor 为 input 中的字节偏移量，返回补全项的文本，为空时不补全
+	Complete func(input string, cursor int) []string
+	// 运行元命令，input 不是元命令时返回 false，为空时不支持元命令
+	Meta func(input string) (string, bool)
+}
+
+// JSON-RPC 服务，供编辑器插件向运行中的 wgo 发送代码
+// 功能需求:
+//   - 每行读取一个请求，每行写入一个响应或者通知，协议见 pkg/rpc
+//   - 请求按顺序处理，interrupt 在读取时立即处理，中断正在运行的代码
+//   - execute 运行时每行输出作为 output 通知实时发送，响应中包含全部输出
+//   - 输入结束时处理完已读取的请求后返回
+type Server struct {
+	opts  Options
+	coder *handler.Coder
+
+	writeMu sync.Mutex
+	w       io.Writer
+
+	runMu  sync.Mutex
+	cancel context.CancelFunc // 正在运行的代码的取消函数
+}
+
+// 创建服务
+func New(opts Options) *Server {
+	coder := opts.Coder
+	if coder == nil {
+		coder = handler.GetCoder()
+	}
+	return &Server{opts: opts, coder: coder}
+}
+
+// 从 r 读取请求，向 w 写入响应，直到 r 结束或者 ctx 结束
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	requests := make(chan rpc.Request, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for req := range requests {
+			s.handle(ctx, req)
+		}
+	}()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			lines <- append([]byte(nil), scanner.Bytes()...)
+		}
+	}()
+
+	defer func() {
+		close(requests)
+		<-done
+	}()
+	for {
+		var line []byte
+		var ok bool
+		select {
+		case <-ctx.Done():
+			s.Interrupt()
+			return nil
+		case line, ok = <-lines:
+		}
+		if !ok {
+			if err := scanner.Err(); err != nil {
+				return fmt.Errorf("读取请求失败: %w", err)
+			}
+			return nil
+		}
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var req rpc.Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.replyError(nil, rpc.CODE_PARSE_ERROR, fmt.Sprintf("解析请求失败: %v", err))
+			continue
+		}
+		if req.JSONRPC != rpc.VERSION || req.Method == "" {
+			s.replyError(req.ID, rpc.CODE_INVALID_REQUEST, "不是合法的 JSON-RPC 2.0 请求")
+			continue
+		}
+		logger.Debugf("收到请求 %s", req.Method)
+		if req.Method == rpc.METHOD_INTERRUPT {
+			s.Interrupt()
+			s.reply(req.ID, nil)
+			continue
+		}
+		requests <- req
+	}
+}
+
+// 中断正在运行的代码
+func (s *Server) Interrupt() {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+func (s *Server) handle(ctx context.Context, req rpc.Request) {
+	switch req.Method {
+	case rpc.METHOD_EXECUTE:
+		var params rpc.ExecuteParams
+		if !s.parseParams(req, &params) {
+			return
+		}
+		s.reply(req.ID, s.execute(ctx, req.ID, params.Code))
+	case rpc.METHOD_COMPLETE:
+		var params rpc.CompleteParams
+		if !s.parseParams(req, &params) {
+			return
+		}
+		if params.Cursor < 0 || params.Cursor > len(params.Code) {
+			s.replyError(req.ID, rpc.CODE_INVALID_PARAMS, fmt.Sprintf("光标位置 %d 超出代码范围", params.Cursor))
+			return
+		}
+		s.reply(req.ID, s.complete(params.Code, params.Cursor))
+	case rpc.METHOD_VARS:
+		vars := make([]rpc.Var, 0)
+		for _, v := range s.coder.Vars() {
+			vars = append(vars, rpc.Var{Name: v.Name, Type: v.Type})
+		}
+		s.reply(req.ID, rpc.VarsResult{Vars: vars})
+	case rpc.METHOD_RESET:
+		if err := s.coder.Reset(); err != nil {
+			s.replyError(req.ID, rpc.CODE_INTERNAL_ERROR, err.Error())
+			return
+		}
+		s.reply(req.ID, nil)
+	case rpc.METHOD_EXPORT:
+		var params rpc.ExportParams
+		if !s.parseParams(req, &params) {
+			return
+		}
+		if params.Format == "" {
+			params.Format = handler.EXPORT_MAIN
+		}
+		code, err := s.coder.Export(params.Format)
+		if err != nil {
+			s.replyError(req.ID, rpc.CODE_INTERNAL_ERROR, err.Error())
+			return
+		}
+		s.reply(req.ID, rpc.ExportResult{Code: code})
+	default:
+		s.replyError(req.ID, rpc.CODE_METHOD_NOT_FOUND, fmt.Sprintf("不支持的方法 %s", req.Method))
+	}
+}
+
+// 运行代码，以 : 开头的输入作为元命令运行
+func (s *Server) execute(ctx context.Context, id *int64, code string) rpc.ExecuteResult {
+	if s.opts.Meta != nil {
+		if out, ok := s.opts.Meta(code); ok {
+			return rpc.ExecuteResult{Output: out}
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if id != nil {
+		runCtx = handler.WithOutputFunc(runCtx, func(line handler.OutputLine) {
+			s.notify(rpc.NOTIFY_OUTPUT, rpc.OutputParams{ID: *id, Text: line.Text, Stderr: line.Stderr})
+		})
+	}
+	s.runMu.Lock()
+	s.cancel = cancel
+	s.runMu.Unlock()
+	defer func() {
+		s.runMu.Lock()
+		s.cancel = nil
+		s.runMu.Unlock()
+	}()
+
+	out, err := s.coder.InputAndRunContext(runCtx, code)
+	res := rpc.ExecuteResult{Output: out}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if cell, ok := s.coder.LastCell(); ok && !s.coder.IsSession() {
+		res.Num = cell.Num
+		res.HasOut = cell.HasOut
+	}
+	return res
+}
+
+// 补全代码，替换光标前的单词
+func (s *Server) complete(code string, cursor int) rpc.CompleteResult {
+	items := []string{}
+	if s.opts.Complete != nil {
+		items = append(items, s.opts.Complete(code, cursor)...)
+	}
+	start := strings.LastIndexAny(code[:cursor], " .()[]{}<>\t\n") + 1
+	return rpc.CompleteResult{Start: start, Items: items}
+}
+
+// 解析参数，失败时回复错误并返回 false
+func (s *Server) parseParams(req rpc.Request, params any) bool {
+	if len(req.Params) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		s.replyError(req.ID, rpc.CODE_INVALID_PARAMS, fmt.Sprintf("解析参数失败: %v", err))
+		return false
+	}
+	return true
+}
+
+// 回复请求，通知没有 id，不需要回复
+func (s *Server) reply(id *int64, result any) {
+	if id == nil {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		s.replyError(id, rpc.CODE_INTERNAL_ERROR, fmt.Sprintf("序列化结果失败: %v", err))
+		return
+	}
+	s.write(rpc.Response{JSONRPC: rpc.VERSION, ID: id, Result: data})
+}
+
+// 回复错误，无法解析的请求 id 为空
+func (s *Server) replyError(id *int64, code int, message string) {
+	s.write(rpc.Response{JSONRPC: rpc.VERSION, ID: id, Error: &rpc.Error{Code: code, Message: message}})
+}
+
+// 发送通知
+func (s *Server) notify(method string, params any) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		logger.Errorf("序列化通知失败: %v", err)
+		return
+	}
+	s.write(rpc.Request{JSONRPC: rpc.VERSION, Method: method, Params: data})
+}
+
+func (s *Server) write(msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Errorf("序列化消息失败: %v", err)
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		logger.Errorf("发送消息失败: %v", err)
+	}
+}
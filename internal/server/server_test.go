@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wxnacy/wgo/internal/handler"
+	"github.com/wxnacy/wgo/pkg/rpc"
+)
+
+// 通过管道连接服务和客户端
+func startServer(t *testing.T, opts Options, onOutput func(rpc.OutputParams)) (*rpc.Client, io.Closer, <-chan error) {
+	t.Helper()
+	handler.Init()
+	t.Cleanup(handler.Destory)
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := New(opts).Serve(context.Background(), reqR, respW)
+		respW.Close()
+		done <- err
+	}()
+	t.Cleanup(func() { reqW.Close() })
+	return rpc.NewClient(respR, reqW, onOutput), reqW, done
+}
+
+func TestServe(t *testing.T) {
+	var mu sync.Mutex
+	var outputs []rpc.OutputParams
+	client, stdin, done := startServer(t, Options{
+		Coder: &handler.Coder{},
+		Complete: func(input string, cursor int) []string {
+			if strings.HasSuffix(input[:cursor], "fmt.Pri") {
+				return []string{"Println", "Printf"}
+			}
+			return nil
+		},
+		Meta: func(input string) (string, bool) {
+			return "meta " + input, strings.HasPrefix(input, ":")
+		},
+	}, func(out rpc.OutputParams) {
+		mu.Lock()
+		defer mu.Unlock()
+		outputs = append(outputs, out)
+	})
+	ctx := context.Background()
+
+	if res, err := client.Execute(ctx, `user := "wgo"`); err != nil || res.Error != "" || res.Num != 1 {
+		t.Fatalf("运行失败: %+v %v", res, err)
+	}
+	if res, err := client.Execute(ctx, `fmt.Println("hello", user)`); err != nil || res.Output != "hello wgo" || res.HasOut {
+		t.Fatalf("运行结果不符合预期: %+v %v", res, err)
+	}
+	res, err := client.Execute(ctx, `strings.ToUpper(user)`)
+	if err != nil || res.Error != "" || res.Num != 3 || !res.HasOut || res.Output != "WGO" {
+		t.Fatalf("运行结果不符合预期: %+v %v", res, err)
+	}
+	mu.Lock()
+	if len(outputs) != 2 || outputs[0].Text != "hello wgo" || outputs[0].ID == 0 || outputs[1].Text != "WGO" || outputs[1].ID == outputs[0].ID {
+		t.Fatalf("实时输出不符合预期: %+v", outputs)
+	}
+	mu.Unlock()
+	if res, err := client.Execute(ctx, `Out[3] + "!"`); err != nil || res.Output != "WGO!" {
+		t.Fatalf("Out[n] 引用失败: %+v %v", res, err)
+	}
+	if res, err := client.Execute(ctx, `undefinedVar + 1`); err != nil || !strings.Contains(res.Error, "undefinedVar") {
+		t.Fatalf("运行失败时应返回错误: %+v %v", res, err)
+	}
+	if res, err := client.Execute(ctx, `:vars`); err != nil || res.Output != "meta :vars" || res.Num != 0 {
+		t.Fatalf("元命令运行失败: %+v %v", res, err)
+	}
+
+	complete, err := client.Complete(ctx, "x := fmt.Pri", 12)
+	if err != nil || complete.Start != 9 || len(complete.Items) != 2 || complete.Items[0] != "Println" {
+		t.Fatalf("补全结果不符合预期: %+v %v", complete, err)
+	}
+	var rpcErr *rpc.Error
+	if _, err := client.Complete(ctx, "fmt", 10); !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CODE_INVALID_PARAMS {
+		t.Fatalf("光标超出范围时应返回参数错误: %v", err)
+	}
+
+	vars, err := client.Vars(ctx)
+	if err != nil || len(vars) != 1 || vars[0] != (rpc.Var{Name: "user", Type: "string"}) {
+		t.Fatalf("变量列表不符合预期: %+v %v", vars, err)
+	}
+
+	code, err := client.Export(ctx, handler.EXPORT_MAIN)
+	if err != nil || !strings.Contains(code, "func main()") || !strings.Contains(code, `user := "wgo"`) {
+		t.Fatalf("导出失败: %v\n%s", err, code)
+	}
+	if _, err := client.Export(ctx, "html"); !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CODE_INTERNAL_ERROR {
+		t.Fatalf("不支持的格式应返回错误: %v", err)
+	}
+
+	if err := client.Reset(ctx); err != nil {
+		t.Fatalf("重置会话失败: %v", err)
+	}
+	if vars, err := client.Vars(ctx); err != nil || len(vars) != 0 {
+		t.Fatalf("重置后不应有变量: %+v %v", vars, err)
+	}
+
+	if err := client.Call(ctx, "unknown", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CODE_METHOD_NOT_FOUND {
+		t.Fatalf("不支持的方法应返回错误: %v", err)
+	}
+
+	// 输入结束后服务退出，之后的请求返回错误
+	stdin.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("服务退出失败: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("输入结束后服务没有退出")
+	}
+	if _, err := client.Vars(ctx); err == nil {
+		t.Fatal("连接关闭后请求应返回错误")
+	}
+}
+
+// ctx 取消时中断运行的代码
+func TestServeInterrupt(t *testing.T) {
+	started := make(chan struct{}, 1)
+	client, _, _ := startServer(t, Options{Coder: &handler.Coder{}}, func(out rpc.OutputParams) {
+		if out.Text == "start" {
+			started <- struct{}{}
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	begin := time.Now()
+	res, err := client.Execute(ctx, `fmt.Println("start")
+time.Sleep(time.Minute)`)
+	if err != nil || !strings.Contains(res.Error, handler.ErrRunInterrupted.Error()) {
+		t.Fatalf("中断后应返回中断错误: %+v %v", res, err)
+	}
+	if time.Since(begin) > 30*time.Second {
+		t.Fatalf("中断耗时过长: %v", time.Since(begin))
+	}
+	if res, err := client.Execute(context.Background(), `1 + 1`); err != nil || res.Output != "2" {
+		t.Fatalf("中断后无法继续运行: %+v %v", res, err)
+	}
+}
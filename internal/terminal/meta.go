@@ -0,0 +1,276 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wxnacy/wgo/internal/handler"
+)
+
+// 元命令前缀，以 : 开头的输入不作为 go 代码运行
+const META_PREFIX = ":"
+
+var (
+	metaCommands   = map[string]*MetaCommand{}
+	metaCommandsMu sync.RWMutex
+)
+
+// 元命令，类似 IPython 的 magic
+// 可以通过 RegisterMetaCommand 注册其他命令
+type MetaCommand struct {
+	Name    string   // 命令名称，不含前缀
+	Aliases []string // 命令别名
+	Usage   string   // 参数说明，比如 <变量名>
+	Help    string   // 命令说明
+	// 运行命令，args 为命令名称之后按空白分割的参数
+	Run func(args []string) (string, error)
+}
+
+func init() {
+	for _, cmd := range []*MetaCommand{
+		{Name: "help", Aliases: []string{"h", "?"}, Help: "查看元命令列表", Run: runHelp},
+		{Name: "vars", Help: "查看保存的变量和类型", Run: runVars},
+		{Name: "code", Help: "查看最近一次生成的 main.go", Run: runCode},
+		{Name: "del", Usage: "<变量名>...", Help: "删除保存的变量", Run: runDel},
+		{Name: "history", Usage: "[条数]", Help: "查看带编号的输入记录", Run: runHistory},
+		{Name: "reset", Help: "重置会话，清空变量、声明和导入", Run: runReset},
+		{Name: "imports", Help: "查看通过 import 语句导入的包", Run: runImports},
+		{Name: "unimport", Usage: "<包名或路径>...", Help: "删除导入的包", Run: runUnimport},
+		{Name: "print", Usage: "[格式]", Help: "查看或设置自动打印的格式", Run: runPrint},
+		{Name: "save", Usage: "<文件>", Help: "保存会话，可以通过 wgo --load 加载", Run: runSave},
+		{Name: "export", Usage: "[文件]", Help: "导出为独立的 Go 代码，_test.go 文件导出为 Example 函数", Run: runExport},
+		{Name: "get", Usage: "<模块路径@版本 | 本地目录 | 模块路径=本地目录>...", Help: "从本地缓存添加依赖", Run: runGet},
+	} {
+		RegisterMetaCommand(cmd)
+	}
+}
+
+// 注册元命令，同名命令会被覆盖
+func RegisterMetaCommand(cmd *MetaCommand) {
+	metaCommandsMu.Lock()
+	defer metaCommandsMu.Unlock()
+	metaCommands[cmd.Name] = cmd
+}
+
+// 获取已注册的元命令，按名称排序
+func MetaCommands() []*MetaCommand {
+	metaCommandsMu.RLock()
+	defer metaCommandsMu.RUnlock()
+	cmds := make([]*MetaCommand, 0, len(metaCommands))
+	for _, cmd := range metaCommands {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+	return cmds
+}
+
+// 通过名称或别名查找元命令
+func lookupMetaCommand(name string) (*MetaCommand, bool) {
+	metaCommandsMu.RLock()
+	defer metaCommandsMu.RUnlock()
+	if cmd, ok := metaCommands[name]; ok {
+		return cmd, true
+	}
+	for _, cmd := range metaCommands {
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// 运行元命令，供 Jupyter 内核等其他前端使用
+// 输入不是元命令时 ok 返回 false
+func RunMetaCommand(input string) (out string, ok bool) {
+	return runMetaCommand(input)
+}
+
+// 运行元命令
+// 输入不是元命令时 ok 返回 false，运行失败时返回红色的错误信息
+func runMetaCommand(input string) (out string, ok bool) {
+	out, ok, err := RunMetaCommandErr(input)
+	if err != nil {
+		return metaError(err.Error()), true
+	}
+	return out, ok
+}
+
+// 运行元命令，运行失败时返回错误，供 wgo run 等需要判断是否失败的调用方使用
+// 输入不是元命令时 ok 返回 false
+func RunMetaCommandErr(input string) (out string, ok bool, err error) {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, META_PREFIX) {
+		return "", false, nil
+	}
+	fields := strings.Fields(strings.TrimPrefix(input, META_PREFIX))
+	if len(fields) == 0 {
+		return "", true, nil
+	}
+	name, args := fields[0], fields[1:]
+
+	cmd, exist := lookupMetaCommand(name)
+	if !exist {
+		return "", true, fmt.Errorf("未知的命令 %s%s，输入 %shelp 查看命令列表", META_PREFIX, name, META_PREFIX)
+	}
+	out, err = cmd.Run(args)
+	return out, true, err
+}
+
+func metaError(msg string) string {
+	return fmt.Sprintf("\033[31m%s\033[0m\n", msg)
+}
+
+func metaUsage(name string) error {
+	cmd, _ := lookupMetaCommand(name)
+	return fmt.Errorf("用法: %s%s %s", META_PREFIX, cmd.Name, cmd.Usage)
+}
+
+func runHelp(args []string) (string, error) {
+	lines := make([]string, 0)
+	for _, cmd := range MetaCommands() {
+		usage := META_PREFIX + cmd.Name
+		if cmd.Usage != "" {
+			usage += " " + cmd.Usage
+		}
+		line := fmt.Sprintf("%-24s %s", usage, cmd.Help)
+		if len(cmd.Aliases) > 0 {
+			line += "，别名: " + META_PREFIX + strings.Join(cmd.Aliases, " "+META_PREFIX)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func runVars(args []string) (string, error) {
+	coder := handler.GetCoder()
+	if coder.IsSession() {
+		return "", errors.New("会话模式下变量保存在子进程中，不支持查看")
+	}
+	lines := make([]string, 0, len(coder.VarNames))
+	for _, v := range coder.Vars() {
+		typeName := v.Type
+		if typeName == "" {
+			typeName = "?"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", v.Name, typeName))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func runHistory(args []string) (string, error) {
+	cells := handler.GetCoder().Cells
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return "", metaUsage("history")
+		}
+		cells = cells[max(len(cells)-n, 0):]
+	}
+	lines := make([]string, 0, len(cells))
+	for _, cell := range cells {
+		line := fmt.Sprintf("In[%d]: %s", cell.Num, cell.Input)
+		if cell.HasOut {
+			line += fmt.Sprintf("  → Out[%d]", cell.Num)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func runCode(args []string) (string, error) {
+	return handler.GetCoder().MainCode()
+}
+
+func runDel(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", metaUsage("del")
+	}
+	for _, arg := range args {
+		if err := handler.GetCoder().DeleteVar(arg); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func runReset(args []string) (string, error) {
+	return "", handler.GetCoder().Reset()
+}
+
+func runSave(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", metaUsage("save")
+	}
+	coder := handler.GetCoder()
+	if err := coder.SaveNotebook(args[0]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("已保存 %d 个输入到 %s", len(coder.Cells), args[0]), nil
+}
+
+func runExport(args []string) (string, error) {
+	coder := handler.GetCoder()
+	switch len(args) {
+	case 0:
+		return coder.Export(handler.EXPORT_MAIN)
+	case 1:
+		if err := coder.ExportFile(args[0]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("已导出到 %s", args[0]), nil
+	}
+	return "", metaUsage("export")
+}
+
+func runImports(args []string) (string, error) {
+	coder := handler.GetCoder()
+	lines := make([]string, 0, len(coder.Imports))
+	for _, imp := range coder.Imports {
+		lines = append(lines, "import "+imp.String())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func runUnimport(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", metaUsage("unimport")
+	}
+	for _, arg := range args {
+		if !handler.GetCoder().RemoveImport(strings.Trim(arg, `"`)) {
+			return "", fmt.Errorf("没有找到导入 %s", arg)
+		}
+	}
+	return "", nil
+}
+
+func runGet(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", metaUsage("get")
+	}
+	var lines []string
+	for _, arg := range args {
+		out, err := handler.GetModule(arg)
+		if err != nil {
+			return "", err
+		}
+		if out != "" {
+			lines = append(lines, out)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func runPrint(args []string) (string, error) {
+	if len(args) == 0 {
+		return fmt.Sprintf("%s（可选: %s）", handler.GetPrintMode(), strings.Join(handler.PrintModes(), ", ")), nil
+	}
+	return "", handler.SetPrintMode(args[0])
+}
@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -33,8 +34,12 @@ var (
 
 func Run() error {
 	// 构建文件URI和工作区URI
-	workspace := handler.GetWorkspace()
+	// 工作区使用会话模块的目录，gopls 按照会话 go.mod 解析依赖和项目中的包
+	workspace := handler.GetMainDir()
 	codePath := handler.GetMainFile()
+	if err := handler.SetPrintColor(true); err != nil {
+		logger.Errorf("开启彩色输出失败: %v", err)
+	}
 
 	// 创建带超时的上下文
 	logger.Debugf("创建带超时的上下文")
@@ -109,7 +114,9 @@ func _Run() error {
 	fmt.Println("gopls已就绪，您可以开始输入了！")
 
 	p := prompt.NewPrompt(
-		prompt.WithOutFunc(outFunc),
+		prompt.WithOutFunc(func(input string) string {
+			return outFunc(ctx, input)
+		}),
 		prompt.WithCompletionFunc(func(input string, cursor int) []prompt.CompletionItem {
 			return completionFunc(input, cursor, client, ctx)
 		}),
@@ -145,13 +152,56 @@ func prepareLSP(ctx context.Context, workspace, codePath string) (*lsp.LSPClient
 	return client, nil
 }
 
-func outFunc(input string) string {
-	out, err := handler.GetCoder().InputAndRun(input)
+// 在后台启动 gopls，返回和终端相同的补全函数，供 Jupyter 内核等其他前端使用
+// gopls 就绪之前或者启动失败时补全函数返回空
+func StartCompleter(ctx context.Context) func(input string, cursor int) []string {
+	var client atomic.Pointer[lsp.LSPClient]
+	go func() {
+		c, err := prepareLSP(ctx, handler.GetMainDir(), handler.GetMainFile())
+		if err != nil {
+			logger.Errorf("初始化gopls失败: %v", err)
+			return
+		}
+		client.Store(c)
+		<-ctx.Done()
+		c.Close()
+	}()
+	return func(input string, cursor int) []string {
+		c := client.Load()
+		if c == nil {
+			return nil
+		}
+		var labels []string
+		for _, item := range completionFunc(input, cursor, c, ctx) {
+			labels = append(labels, item.Text)
+		}
+		return labels
+	}
+}
+
+func outFunc(ctx context.Context, input string) string {
+	if out, ok := runMetaCommand(input); ok {
+		return out
+	}
+	return evalInput(ctx, input)
+}
+
+// 运行输入的代码，返回需要显示的内容
+// 中断时显示黄色的提示，其他错误显示为红色
+func evalInput(ctx context.Context, input string) string {
+	coder := handler.GetCoder()
+	out, err := coder.InputAndRunContext(ctx, input)
+	if errors.Is(err, handler.ErrRunInterrupted) {
+		return fmt.Sprintf("\033[33m%v\033[0m\n", err)
+	}
 	if err != nil {
 		return fmt.Sprintf("\033[31m%v\033[0m\n", err)
-	} else {
-		return out
 	}
+	// 保存了输出结果时显示编号，之后可以通过 _n、Out[n] 引用
+	if cell, ok := coder.LastCell(); ok && cell.HasOut {
+		return fmt.Sprintf("\033[31mOut[%d]:\033[0m %s", cell.Num, out)
+	}
+	return out
 }
 
 func completionSelectFunc(p *prompt.Prompt, input string, cursor int, selected prompt.CompletionItem) {
@@ -2,20 +2,153 @@ package terminal
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	prompt "github.com/wxnacy/code-prompt"
 	"github.com/wxnacy/code-prompt/pkg/lsp"
+	"github.com/wxnacy/wgo/internal/handler"
 )
 
+const (
+	PROMPT          = ">>> "      // 输入组件默认的提示符，显示时替换为带编号的提示符
+	IN_PROMPT       = "In [%d]: " // 输入提示符，编号为下一次输入的编号
+	CONTINUE_PROMPT = "...: "     // 多行输入时的续行提示符，右对齐到输入提示符
+	RUNNING_HINT    = "\033[90m运行中，输入内容按回车发送到 stdin，Ctrl+D 结束输入，Ctrl+C 中断\033[0m"
+	RUNNING_TAIL    = 20 // 运行中显示最近输出的行数
+)
+
+// 后台运行结束的消息
+type runDoneMsg struct {
+	out string
+}
+
+// 运行中有新的实时输出的消息
+type runOutputMsg struct {
+	running *runningInput
+}
+
+// 正在后台运行的输入
+type runningInput struct {
+	cancel  context.CancelFunc
+	done    chan string
+	waiting bool // 是否已经返回等待运行结束的 tea.Cmd
+
+	stdin *os.File // 运行代码的 stdin，为空时不能输入
+	typed []rune   // 正在输入的一行
+
+	mu       sync.Mutex
+	tail     []handler.OutputLine // 最近的实时输出以及输入的行
+	notify   chan struct{}        // 有新的实时输出时通知界面刷新，运行结束后关闭
+	finished bool
+}
+
+// 保存一行实时输出，不等待界面刷新，避免输出较多时拖慢运行的代码
+func (r *runningInput) append(line handler.OutputLine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	r.tail = append(r.tail, line)
+	if len(r.tail) > RUNNING_TAIL {
+		r.tail = r.tail[len(r.tail)-RUNNING_TAIL:]
+	}
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// 运行结束，不再接收实时输出
+func (r *runningInput) finish(out string) {
+	r.mu.Lock()
+	r.finished = true
+	close(r.notify)
+	r.mu.Unlock()
+	r.closeStdin()
+	r.done <- out
+}
+
+// 处理运行中的按键，输入的内容按行发送到 stdin
+// 运行结束前 stdin 可能已经被关闭，写入失败时忽略
+func (r *runningInput) handleKey(key tea.KeyMsg) {
+	switch key.Type {
+	case tea.KeyCtrlC:
+		r.cancel()
+	case tea.KeyCtrlD:
+		r.closeStdin()
+	case tea.KeyEnter:
+		if r.stdin == nil {
+			return
+		}
+		line := string(r.typed)
+		r.typed = nil
+		r.append(handler.OutputLine{Text: line})
+		r.stdin.WriteString(line + "\n")
+	case tea.KeyBackspace:
+		if len(r.typed) > 0 {
+			r.typed = r.typed[:len(r.typed)-1]
+		}
+	case tea.KeySpace:
+		r.typed = append(r.typed, ' ')
+	case tea.KeyRunes:
+		r.typed = append(r.typed, key.Runes...)
+	}
+}
+
+// 关闭 stdin，运行的代码读取到 EOF
+func (r *runningInput) closeStdin() {
+	if r.stdin != nil {
+		r.stdin.Close()
+	}
+}
+
+// 等待运行结束
+func (r *runningInput) wait() tea.Cmd {
+	return func() tea.Msg {
+		return runDoneMsg{out: <-r.done}
+	}
+}
+
+// 等待新的实时输出
+func (r *runningInput) next() tea.Cmd {
+	return func() tea.Msg {
+		if _, ok := <-r.notify; !ok {
+			return nil
+		}
+		return runOutputMsg{running: r}
+	}
+}
+
+// 运行中的提示以及最近的实时输出，stderr 使用灰色显示
+func (r *runningInput) View() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines := make([]string, 0, len(r.tail)+1)
+	for _, line := range r.tail {
+		if line.Stderr {
+			line.Text = "\033[90m" + line.Text + "\033[0m"
+		}
+		lines = append(lines, line.Text)
+	}
+	if len(r.typed) > 0 {
+		lines = append(lines, string(r.typed))
+	}
+	return strings.Join(append(lines, RUNNING_HINT), "\n")
+}
+
 func NewWgo(ctx context.Context) *Wgo {
 	m := &Wgo{
 		ctx: ctx,
 	}
 	p := prompt.NewPrompt(
 		prompt.WithHistoryFile("~/.wgo_history"),
-		prompt.WithOutFunc(outFunc),
+		prompt.WithOutFunc(m.outFunc),
 		prompt.WithCompletionSelectFunc(prompt.DefaultCompletionLSPSelectFunc),
 	)
 	m.prompt = p
@@ -29,6 +162,10 @@ type Wgo struct {
 	lspClient *lsp.LSPClient
 
 	prompt *prompt.Prompt
+
+	lines        []string      // 多行输入中已经输入的行
+	forceNewline bool          // 通过 Alt+Enter 强制换行
+	running      *runningInput // 正在运行的输入，为空时没有运行中的代码
 }
 
 func (m Wgo) Init() tea.Cmd {
@@ -36,11 +173,100 @@ func (m Wgo) Init() tea.Cmd {
 }
 
 func (m Wgo) View() string {
-	return m.prompt.View()
+	if m.running != nil {
+		return m.running.View()
+	}
+	return strings.Replace(m.prompt.View(), PROMPT, m.promptText(), 1)
+}
+
+// 当前显示的提示符
+// 每次输入运行后编号更新为下一次输入的编号，多行输入中显示和输入提示符等宽的续行提示符
+func (m Wgo) promptText() string {
+	text := fmt.Sprintf(IN_PROMPT, handler.GetCoder().NextCellNum())
+	if len(m.lines) > 0 {
+		return fmt.Sprintf("%*s", len(text), CONTINUE_PROMPT)
+	}
+	return text
+}
+
+// 处理回车提交的输入
+// 功能需求:
+// - 和之前输入的行拼接，括号、反引号等没有闭合时继续输入下一行，输入完整后再运行
+// - Alt+Enter 提交的行不运行，强制换行
+// - 元命令直接运行，代码在后台运行，界面可以继续响应 Ctrl+C
+// - 运行中实时显示最近的输出，运行结束后打印全部输出
+func (m *Wgo) outFunc(input string) string {
+	lines := append(m.lines, input)
+	code := strings.Join(lines, "\n")
+	if m.forceNewline || !handler.IsCompleteInput(code) {
+		m.forceNewline = false
+		m.lines = lines
+		return ""
+	}
+	m.lines = nil
+	if out, ok := runMetaCommand(code); ok {
+		return out
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	running := &runningInput{
+		cancel: cancel,
+		done:   make(chan string, 1),
+		notify: make(chan struct{}, 1),
+	}
+	ctx = handler.WithOutputFunc(ctx, running.append)
+	stdin, stdinWriter, err := os.Pipe()
+	if err != nil {
+		logger.Errorf("创建 stdin 管道失败: %v", err)
+	} else {
+		running.stdin = stdinWriter
+		ctx = handler.WithStdin(ctx, stdin)
+	}
+	go func() {
+		defer cancel()
+		out := evalInput(ctx, code)
+		if stdin != nil {
+			stdin.Close()
+		}
+		running.finish(out)
+	}()
+	m.running = running
+	return ""
 }
 
+// 功能需求:
+// - 代码运行中按键交给运行的代码，输入的行发送到 stdin，Ctrl+C 结束运行的代码，不退出 wgo
+// - 运行中收到实时输出时更新显示，运行结束后打印输出，恢复输入
 func (m *Wgo) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
+	if done, ok := msg.(runDoneMsg); ok {
+		m.running = nil
+		if out := strings.TrimRight(done.out, "\n"); out != "" {
+			return m, tea.Println(out)
+		}
+		return m, nil
+	}
+	if output, ok := msg.(runOutputMsg); ok {
+		// 收到消息后界面会重新渲染，继续等待下一次输出
+		return m, output.running.next()
+	}
+	if key, ok := msg.(tea.KeyMsg); ok && m.running != nil {
+		m.running.handleKey(key)
+		return m, nil
+	}
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case key.Type == tea.KeyEnter && key.Alt:
+			// 按照普通回车提交当前行，但不运行
+			m.forceNewline = true
+			key.Alt = false
+			msg = key
+		case key.Type == tea.KeyCtrlC && len(m.lines) > 0:
+			// 多行输入中按 Ctrl+C 放弃已经输入的行
+			m.lines = nil
+			m.prompt.SetValue("")
+			return m, nil
+		}
+	}
 	// lsp 启动后，设置补全方法
 	if m.lspClient != nil {
 		m.prompt.CompletionFunc(func(input string, cursor int) []prompt.CompletionItem {
@@ -49,6 +275,10 @@ func (m *Wgo) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 	model, cmd := m.prompt.Update(msg)
 	m.prompt = model.(*prompt.Prompt)
+	if m.running != nil && !m.running.waiting {
+		m.running.waiting = true
+		cmd = tea.Batch(cmd, m.running.wait(), m.running.next())
+	}
 	return m, cmd
 }
 
@@ -0,0 +1,215 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var ErrClosed = errors.New("连接已关闭")
+
+// wgo serve 的客户端
+// 功能需求:
+//   - 请求可以并发发送，服务端按顺序处理，响应通过 id 对应到请求
+//   - execute 请求的 ctx 取消时发送 interrupt 通知中断运行的代码，并继续等待响应
+//   - 运行代码时的实时输出通过 onOutput 接收
+//
+// 比如连接 wgo serve --stdio 子进程
+//
+//	cmd := exec.Command("wgo", "serve", "--stdio")
+//	stdin, _ := cmd.StdinPipe()
+//	stdout, _ := cmd.StdoutPipe()
+//	cmd.Start()
+//	client := rpc.NewClient(stdout, stdin, nil)
+//	res, err := client.Execute(ctx, `strings.ToUpper("wgo")`)
+type Client struct {
+	w        io.Writer
+	onOutput func(OutputParams)
+
+	mu      sync.Mutex // 保护 w、nextID 和 pending
+	nextID  int64
+	pending map[int64]chan *Response
+	err     error // 读取响应失败的原因，不为空时连接已关闭
+}
+
+// 创建客户端，从 r 读取响应，向 w 发送请求，onOutput 为空时忽略实时输出
+func NewClient(r io.Reader, w io.Writer, onOutput func(OutputParams)) *Client {
+	c := &Client{w: w, onOutput: onOutput, pending: make(map[int64]chan *Response)}
+	go c.read(r)
+	return c
+}
+
+// 读取响应和通知，直到 r 结束
+func (c *Client) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var msg struct {
+			Response
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Method != "" {
+			if msg.Method == NOTIFY_OUTPUT && c.onOutput != nil {
+				var out OutputParams
+				if err := json.Unmarshal(msg.Params, &out); err == nil {
+					c.onOutput(out)
+				}
+			}
+			continue
+		}
+		if msg.ID == nil {
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[*msg.ID]
+		delete(c.pending, *msg.ID)
+		c.mu.Unlock()
+		if ok {
+			resp := msg.Response
+			ch <- &resp
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = ErrClosed
+	}
+	c.mu.Lock()
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
+
+// 发送一行消息
+func (c *Client) write(req Request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
+
+// 发送通知，不等待响应
+func (c *Client) Notify(method string, params any) error {
+	req := Request{JSONRPC: VERSION, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = data
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.write(req)
+}
+
+// 发送请求并等待响应，result 为空时忽略结果
+// ctx 取消时返回 ctx.Err()，服务端的错误返回 *Error
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	req := Request{JSONRPC: VERSION, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("序列化参数失败: %w", err)
+		}
+		req.Params = data
+	}
+	ch := make(chan *Response, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	req.ID = &id
+	c.pending[id] = ch
+	err := c.write(req)
+	if err != nil {
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("发送请求失败: %w", err)
+	}
+
+	var resp *Response
+	select {
+	case resp = <-ch:
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+	if resp == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// 运行代码，ctx 取消时中断运行的代码，返回中断后的运行结果
+func (c *Client) Execute(ctx context.Context, code string) (*ExecuteResult, error) {
+	stop := context.AfterFunc(ctx, func() {
+		c.Notify(METHOD_INTERRUPT, nil)
+	})
+	defer stop()
+	var res ExecuteResult
+	if err := c.Call(context.WithoutCancel(ctx), METHOD_EXECUTE, ExecuteParams{Code: code}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 补全 code 中 cursor 处的代码
+func (c *Client) Complete(ctx context.Context, code string, cursor int) (*CompleteResult, error) {
+	var res CompleteResult
+	if err := c.Call(ctx, METHOD_COMPLETE, CompleteParams{Code: code, Cursor: cursor}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 列出保存的变量
+func (c *Client) Vars(ctx context.Context) ([]Var, error) {
+	var res VarsResult
+	if err := c.Call(ctx, METHOD_VARS, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Vars, nil
+}
+
+// 重置会话
+func (c *Client) Reset(ctx context.Context) error {
+	return c.Call(ctx, METHOD_RESET, nil, nil)
+}
+
+// 导出会话，format 为 main 或者 example
+func (c *Client) Export(ctx context.Context, format string) (string, error) {
+	var res ExportResult
+	if err := c.Call(ctx, METHOD_EXPORT, ExportParams{Format: format}, &res); err != nil {
+		return "", err
+	}
+	return res.Code, nil
+}
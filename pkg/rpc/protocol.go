@@ -0,0 +1,107 @@
+// wgo serve 使用的 JSON-RPC 2.0 协议
+// 每条消息是一行 JSON，以换行符结束，请求和响应通过 id 对应
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const VERSION = "2.0" // JSON-RPC 版本
+
+// 请求的方法
+const (
+	METHOD_EXECUTE   = "execute"   // 运行代码，参数 ExecuteParams，结果 ExecuteResult
+	METHOD_COMPLETE  = "complete"  // 补全代码，参数 CompleteParams，结果 CompleteResult
+	METHOD_VARS      = "vars"      // 列出保存的变量，结果 VarsResult
+	METHOD_RESET     = "reset"     // 重置会话，结果为 null
+	METHOD_EXPORT    = "export"    // 导出会话，参数 ExportParams，结果 ExportResult
+	METHOD_INTERRUPT = "interrupt" // 中断正在运行的代码，可以作为通知发送，结果为 null
+)
+
+// 服务端发送的通知
+const (
+	NOTIFY_OUTPUT = "output" // 运行代码时的实时输出，参数 OutputParams
+)
+
+// 错误码
+const (
+	CODE_PARSE_ERROR      = -32700 // 不是合法的 JSON
+	CODE_INVALID_REQUEST  = -32600 // 不是合法的请求
+	CODE_METHOD_NOT_FOUND = -32601 // 方法不存在
+	CODE_INVALID_PARAMS   = -32602 // 参数不正确
+	CODE_INTERNAL_ERROR   = -32603 // 处理请求失败
+)
+
+// 请求和通知，通知没有 id
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// 响应，Result 和 Error 只有一个不为空
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// 响应中的错误
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+type ExecuteParams struct {
+	Code string `json:"code"`
+}
+
+// 运行结果，运行失败不是 JSON-RPC 错误，通过 Error 返回
+type ExecuteResult struct {
+	Num    int    `json:"num"`     // 输入编号，可以通过 Out[n] 引用，元命令和会话模式下为 0
+	Output string `json:"output"`  // 全部输出
+	Error  string `json:"error"`   // 运行失败时的错误
+	HasOut bool   `json:"has_out"` // 是否保存了输出结果
+}
+
+// 补全光标处的代码
+type CompleteParams struct {
+	Code   string `json:"code"`
+	Cursor int    `json:"cursor"` // 光标在 Code 中的字节偏移量
+}
+
+type CompleteResult struct {
+	Start int      `json:"start"` // 补全项替换 Code[Start:Cursor]
+	Items []string `json:"items"`
+}
+
+type Var struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type VarsResult struct {
+	Vars []Var `json:"vars"`
+}
+
+type ExportParams struct {
+	Format string `json:"format"` // main 或者 example，为空时为 main
+}
+
+type ExportResult struct {
+	Code string `json:"code"`
+}
+
+// 运行代码时的一行输出
+type OutputParams struct {
+	ID     int64  `json:"id"` // 对应的 execute 请求
+	Text   string `json:"text"`
+	Stderr bool   `json:"stderr"`
+}
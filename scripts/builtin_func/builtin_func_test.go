@@ -1,9 +1,13 @@
 package main
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type testSample struct {
@@ -67,4 +71,138 @@ func resetFuncRegistryForTest() {
 	defer funcRegistryMu.Unlock()
 	funcRegistry = map[string]any{}
 	funcPointerRegistry = map[uintptr]string{}
+	funcSourceRegistry = map[uintptr]string{}
+}
+
+type printUser struct {
+	Name  string
+	Age   int
+	Tags  []string
+	Boss  *printUser
+	inner int
+}
+
+func TestFormatValuePretty(t *testing.T) {
+	PrintMode, PrintColor = PRINT_MODE_PRETTY, false
+	boss := &printUser{Name: "Ann"}
+	cases := []struct {
+		value  any
+		expect string
+	}{
+		{nil, "nil"},
+		{"hello", "hello"},
+		{3, "3"},
+		{errors.New("boom"), "boom"},
+		{[]string{"a", "b"}, `[]string{"a", "b"}`},
+		{[]int(nil), "[]int(nil)"},
+		{map[string]int{"b": 2, "a": 1}, `map[string]int{"a": 1, "b": 2}`},
+		{boss, `&printUser{Name: "Ann", Age: 0, Tags: []string(nil), Boss: nil, inner: 0}`},
+		{struct{ A int }{1}, "struct{A: 1}"},
+		{[]time.Month{time.May}, "[]time.Month{May}"},
+		{map[string]*time.Location(nil), "map[string]*time.Location(nil)"},
+		{
+			printUser{Name: "Bob", Age: 32, Tags: []string{"go", "test"}, Boss: boss},
+			"printUser{\n" +
+				"  Name: \"Bob\",\n" +
+				"  Age: 32,\n" +
+				"  Tags: []string{\"go\", \"test\"},\n" +
+				"  Boss: &printUser{Name: \"Ann\", Age: 0, Tags: []string(nil), Boss: nil, inner: 0},\n" +
+				"  inner: 0,\n" +
+				"}",
+		},
+	}
+	for _, c := range cases {
+		if got := formatValue(c.value); got != c.expect {
+			t.Fatalf("formatValue(%#v)\nexpect: %s\n   got: %s", c.value, c.expect, got)
+		}
+	}
+
+	long := make([]int, printMaxItems+5)
+	if got := formatValue(long); !strings.Contains(got, "...（共 105 项）") {
+		t.Fatalf("超长切片没有截断: %s", got)
+	}
+
+	loop := &printUser{Name: "loop"}
+	loop.Boss = loop
+	if got := formatValue(loop); !strings.Contains(got, "&<循环引用>") {
+		t.Fatalf("循环引用处理不符合预期: %s", got)
+	}
+}
+
+// 只去掉 main 包的前缀，包名以 main 结尾的其他包保持不变
+func TestTrimMainPrefix(t *testing.T) {
+	cases := map[string]string{
+		"main.User":                "User",
+		"[]*main.User":             "[]*User",
+		"map[main.Key]main.User":   "map[Key]User",
+		"domain.User":              "domain.User",
+		"[]domain.User":            "[]domain.User",
+		"map[string]*domain.User":  "map[string]*domain.User",
+		"func(main.User) domain.X": "func(User) domain.X",
+	}
+	for name, expect := range cases {
+		if got := trimMainPrefix(name); got != expect {
+			t.Fatalf("trimMainPrefix(%q) 期望 %q，实际 %q", name, expect, got)
+		}
+	}
+}
+
+func TestFormatValueModes(t *testing.T) {
+	defer func() { PrintMode, PrintColor = "", false }()
+	value := struct {
+		Name string `json:"name"`
+	}{"wgo"}
+	cases := map[string]string{
+		PRINT_MODE_V:      "{wgo}",
+		PRINT_MODE_PLUS_V: "{Name:wgo}",
+		PRINT_MODE_SHARP:  `struct { Name string "json:\"name\"" }{Name:"wgo"}`,
+		PRINT_MODE_JSON:   "{\n  \"name\": \"wgo\"\n}",
+	}
+	for mode, expect := range cases {
+		PrintMode = mode
+		if got := formatValue(value); got != expect {
+			t.Fatalf("%s 模式\nexpect: %s\n   got: %s", mode, expect, got)
+		}
+	}
+
+	PrintMode, PrintColor = PRINT_MODE_PRETTY, true
+	if got := formatValue([]int{1}); got != colorType+"[]int"+colorReset+"{"+colorNumber+"1"+colorReset+"}" {
+		t.Fatalf("颜色输出不符合预期: %q", got)
+	}
+}
+
+func TestPrintOutSerializesSingleValue(t *testing.T) {
+	TempDir = t.TempDir()
+	defer func() { TempDir = "" }()
+
+	_PrintOut(1, 42)
+	if value, err := _Deserialize[int]("out-1"); err != nil || value != 42 {
+		t.Fatalf("输出结果没有保存: %v %v", value, err)
+	}
+	_PrintOut(2, 1, nil)
+	_PrintOut(3, func() {})
+	for _, name := range []string{"out-2.type", "out-3.type"} {
+		if _, err := os.Stat(filepath.Join(TempDir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s 不应保存: %v", name, err)
+		}
+	}
+}
+
+func TestFormatItem(t *testing.T) {
+	defer func() { PrintMode = "" }()
+	cases := map[string]string{
+		PRINT_MODE_PRETTY: `"wgo"`,
+		PRINT_MODE_V:      `"wgo"`,
+		PRINT_MODE_SHARP:  `"wgo"`,
+	}
+	for mode, expect := range cases {
+		PrintMode = mode
+		if got := formatItem("wgo"); got != expect {
+			t.Fatalf("%s 模式\nexpect: %s\n   got: %s", mode, expect, got)
+		}
+	}
+	PrintMode = ""
+	if got := formatItem(1); got != "1" {
+		t.Fatalf("数字格式不符合预期: %s", got)
+	}
 }
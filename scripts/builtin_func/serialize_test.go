@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -97,3 +98,45 @@ func TestSerializeAndDeserializeFunctionValue(t *testing.T) {
 		t.Fatalf("unexpected restored result: %s", restored())
 	}
 }
+
+// 闭包函数序列化时保存源码，跨进程（注册表为空）时提示通过源码重建
+func TestSerializeFuncKeepsClosureSource(t *testing.T) {
+	resetFuncRegistryForTest()
+	TempDir = t.TempDir()
+	name := "var-inc"
+	defer func() {
+		TempDir = ""
+		resetFuncRegistryForTest()
+	}()
+
+	count := 1
+	inc := func() int { count++; return count }
+	source := "func() int { count++; return count }"
+	if err := _SerializeFunc(name, inc, source); err != nil {
+		t.Fatalf("SerializeFunc error: %v", err)
+	}
+
+	record, err := readFunctionRecord(filepath.Join(GetSerializeDir(), name))
+	if err != nil {
+		t.Fatalf("readFunctionRecord error: %v", err)
+	}
+	if record.Source != source {
+		t.Fatalf("unexpected source: %q", record.Source)
+	}
+
+	// 同一进程内可以直接还原，闭包状态保持一致
+	restored, err := _Deserialize[func() int](name)
+	if err != nil {
+		t.Fatalf("Deserialize func error: %v", err)
+	}
+	if got := restored(); got != 2 || count != 2 {
+		t.Fatalf("unexpected closure result: %d, count %d", got, count)
+	}
+
+	// 模拟新的进程
+	resetFuncRegistryForTest()
+	_, err = _Deserialize[func() int](name)
+	if err == nil || !strings.Contains(err.Error(), source) {
+		t.Fatalf("expected rebuild error with source, got %v", err)
+	}
+}